@@ -0,0 +1,227 @@
+/*
+	The TLSHandshakeDone hook (connection-pooling) receives the
+	tls.ConnectionState once the handshake is over, but a trace hook can only
+	observe. To refuse a server whose key is not the one we expect, the check
+	has to run inside the handshake: tls.Config.VerifyConnection is called
+	after the usual chain verification, and an error there aborts the
+	handshake before any byte of the request is sent.
+
+	A pin is the SHA-256 of the SubjectPublicKeyInfo of a certificate, in
+	base64, written "sha256/<base64>" like in HPKP and curl --pinnedpubkey:
+
+		openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der \
+			| openssl dgst -sha256 -binary | base64
+
+	Pinning the key rather than the certificate survives renewals that keep
+	the key. A host matches when any certificate of a verified chain has one
+	of its pins, so a host can pin its leaf key and, as a backup, the key of
+	the next one (or of the intermediate CA) to rotate without an outage.
+	NewTransport requires that backup: a host with a single pin is refused.
+	If chain verification is disabled (InsecureSkipVerify) only the leaf is
+	checked: the other certificates sent by the server prove nothing.
+
+	The pins of a host go in the VerifyConnection of a tls.Config, and the
+	tls.Config belongs to a Transport, so Transport keeps one http.Transport
+	per pinned host (cloned from the base one) and sends the other hosts to
+	the base transport. A DialTLSContext of the base transport does the
+	handshake itself, with its own tls.Config, so its connections are
+	checked against the pins once it returns.
+
+*/
+
+package pinning
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SPKIPin returns the pin of the public key of cert, as "sha256/<base64>".
+func SPKIPin(cert *x509.Certificate) string{
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// normalizePin accepts "sha256/<base64>" or a bare base64 digest.
+func normalizePin(pin string) (string, error){
+	digest := strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+	raw, err := base64.StdEncoding.DecodeString(digest)
+	if err != nil || len(raw) != sha256.Size{
+		return "", fmt.Errorf("pinning: invalid SHA-256 pin %q", pin)
+	}
+	return "sha256/" + digest, nil
+}
+
+// PinMismatchError is returned (wrapped in a *url.Error) when no certificate of the server chain matches the pins of the host.
+type PinMismatchError struct{
+	Host		string
+	// Got are the pins of the certificates presented by the server, leaf first.
+	Got			[]string
+	Expected	[]string
+}
+
+func (e *PinMismatchError) Error() string{
+	return fmt.Sprintf("pinning: no public key of %s matches its pins (got %s)", e.Host, strings.Join(e.Got, ", "))
+}
+
+// verifyPins returns the VerifyConnection function checking the pins of host.
+func verifyPins(host string, pins []string) func(tls.ConnectionState) error{
+	expected := map[string]bool{}
+	for _, p := range pins{
+		expected[p] = true
+	}
+	return func(cs tls.ConnectionState) error{
+		var candidates []*x509.Certificate
+		for _, chain := range cs.VerifiedChains{
+			candidates = append(candidates, chain...)
+		}
+		if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0{
+			candidates = cs.PeerCertificates[:1]
+		}
+		for _, c := range candidates{
+			if expected[SPKIPin(c)]{
+				return nil
+			}
+		}
+		got := make([]string, 0, len(cs.PeerCertificates))
+		for _, c := range cs.PeerCertificates{
+			got = append(got, SPKIPin(c))
+		}
+		return &PinMismatchError{Host: host, Got: got, Expected: append([]string(nil), pins...)}
+	}
+}
+
+type Transport struct{
+	base		*http.Transport
+	pins		map[string][]string
+
+	mu			sync.Mutex
+	transports	map[string]*http.Transport
+}
+
+// NewTransport pins the hosts of pins (host name or IP, without port) on top of base, http.DefaultTransport if nil.
+// Every host needs at least two pins, its current key and a backup: a key can only be rotated to a key that is already pinned.
+func NewTransport(base *http.Transport, pins map[string][]string) (*Transport, error){
+	if base == nil{
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t := &Transport{base: base, pins: map[string][]string{}, transports: map[string]*http.Transport{}}
+	for host, hostPins := range pins{
+		if len(hostPins) == 0{
+			return nil, fmt.Errorf("pinning: no pin for %s", host)
+		}
+		host = strings.ToLower(host)
+		seen := map[string]bool{}
+		for _, p := range hostPins{
+			n, err := normalizePin(p)
+			if err != nil{
+				return nil, err
+			}
+			if !seen[n]{
+				seen[n] = true
+				t.pins[host] = append(t.pins[host], n)
+			}
+		}
+		if len(t.pins[host]) < 2{
+			return nil, fmt.Errorf("pinning: %s has a single pin, add a backup pin", host)
+		}
+	}
+	return t, nil
+}
+
+func (t *Transport) transportFor(host string) *http.Transport{
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tr, ok := t.transports[host]; ok{
+		return tr
+	}
+	tr := t.base.Clone()
+	if tr.TLSClientConfig == nil{
+		tr.TLSClientConfig = &tls.Config{}
+	}
+	next := tr.TLSClientConfig.VerifyConnection
+	check := verifyPins(host, t.pins[host])
+	tr.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error{
+		if next != nil{
+			if err := next(cs); err != nil{
+				return err
+			}
+		}
+		return check(cs)
+	}
+
+	// a DialTLSContext does not use TLSClientConfig, its connections are checked after the handshake
+	dialTLS := tr.DialTLSContext
+	if dialTLS == nil && tr.DialTLS != nil{
+		dialTLS = func(ctx context.Context, network, addr string) (net.Conn, error){
+			return tr.DialTLS(network, addr)
+		}
+	}
+	if dialTLS != nil{
+		tr.DialTLS = nil
+		tr.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error){
+			conn, err := dialTLS(ctx, network, addr)
+			if err != nil{
+				return nil, err
+			}
+			tc, ok := conn.(*tls.Conn)
+			if !ok{
+				conn.Close()
+				return nil, fmt.Errorf("pinning: the TLS dialer of %s returned a %T, the pins cannot be checked", host, conn)
+			}
+			if err := tc.HandshakeContext(ctx); err != nil{
+				tc.Close()
+				return nil, err
+			}
+			if err := check(tc.ConnectionState()); err != nil{
+				tc.Close()
+				return nil, err
+			}
+			return tc, nil
+		}
+	}
+	t.transports[host] = tr
+	return tr
+}
+
+func (t *Transport) RoundTrip(r *http.Request)(*http.Response, error){
+	host := strings.ToLower(r.URL.Hostname())
+	if _, ok := t.pins[host]; !ok{
+		return t.base.RoundTrip(r)
+	}
+	if r.URL.Scheme != "https"{
+		// plain http would silently bypass the pins
+		if r.Body != nil{
+			r.Body.Close()
+		}
+		return nil, fmt.Errorf("pinning: refusing %s request to pinned host %s", r.URL.Scheme, host)
+	}
+	return t.transportFor(host).RoundTrip(r)
+}
+
+func (t *Transport) CloseIdleConnections(){
+	t.base.CloseIdleConnections()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tr := range t.transports{
+		tr.CloseIdleConnections()
+	}
+}
+
+func createClientWithPinning(d time.Duration, pins map[string][]string) (*http.Client, error){
+	transport, err := NewTransport(nil, pins)
+	if err != nil{
+		return nil, err
+	}
+	client := http.Client{Timeout: d, Transport: transport}
+	return &client, nil
+}
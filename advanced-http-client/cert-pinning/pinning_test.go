@@ -0,0 +1,163 @@
+package pinning
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startTestTLSServer() *httptest.Server{
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello World")
+	}))
+	return ts
+}
+
+// otherPin is a valid pin matching no key of the test server.
+func otherPin(s string) string{
+	sum := sha256.Sum256([]byte(s))
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func clientFor(t *testing.T, ts *httptest.Server, pins map[string][]string) *http.Client{
+	t.Helper()
+	// the test server certificate is only trusted by its own transport
+	transport, err := NewTransport(ts.Client().Transport.(*http.Transport), pins)
+	if err != nil{
+		t.Fatal(err)
+	}
+	return &http.Client{Timeout: 5 *time.Second, Transport: transport}
+}
+
+func TestMatchingPin(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+
+	client := clientFor(t, ts, map[string][]string{"127.0.0.1": {SPKIPin(ts.Certificate()), otherPin("backup")}})
+	resp, err := client.Get(ts.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "Hello World"{
+		t.Errorf("Expected Hello World, Got: %s", body)
+	}
+}
+
+func TestBackupPin(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+
+	// the current key is the backup pin, as during a rotation; a bare base64 digest is accepted too
+	current := strings.TrimPrefix(SPKIPin(ts.Certificate()), "sha256/")
+	client := clientFor(t, ts, map[string][]string{"127.0.0.1": {otherPin("next key"), current}})
+	resp, err := client.Get(ts.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestPinMismatch(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+
+	client := clientFor(t, ts, map[string][]string{"127.0.0.1": {otherPin("a"), otherPin("b")}})
+	_, err := client.Get(ts.URL)
+	var pinErr *PinMismatchError
+	if !errors.As(err, &pinErr){
+		t.Fatalf("Expected a *PinMismatchError, Got: %v", err)
+	}
+	if pinErr.Host != "127.0.0.1" || len(pinErr.Got) == 0 || pinErr.Got[0] != SPKIPin(ts.Certificate()){
+		t.Errorf("Expected the error to carry the host and the server pins, Got: %+v", pinErr)
+	}
+}
+
+func TestUnpinnedHost(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+
+	client := clientFor(t, ts, map[string][]string{"registry.example.com": {otherPin("a"), otherPin("b")}})
+	resp, err := client.Get(ts.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestPlainHTTPToPinnedHost(t *testing.T){
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected the request not to reach the server")
+	}))
+	defer ts.Close()
+
+	client, err := createClientWithPinning(5 *time.Second, map[string][]string{"127.0.0.1": {otherPin("a"), otherPin("b")}})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ts.URL); err == nil{
+		t.Fatal("Expected plain http to a pinned host to be refused")
+	}
+}
+
+func TestInvalidPins(t *testing.T){
+	for _, pins := range []map[string][]string{
+		{"example.com": {}},
+		// no backup pin
+		{"example.com": {otherPin("a")}},
+		{"example.com": {otherPin("a"), otherPin("a")}},
+		{"example.com": {"sha256/not base64", otherPin("a")}},
+		{"example.com": {"sha256/" + base64.StdEncoding.EncodeToString([]byte("too short")), otherPin("a")}},
+	}{
+		if _, err := NewTransport(nil, pins); err == nil{
+			t.Errorf("Expected an error for %v", pins)
+		}
+	}
+}
+
+func TestPinsWithDialTLSContext(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+
+	// a dialer doing its own handshake never sees the VerifyConnection of TLSClientConfig
+	tlsConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig
+	base := &http.Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, network, addr)
+		},
+	}
+	transport, err := NewTransport(base, map[string][]string{"127.0.0.1": {otherPin("a"), otherPin("b")}})
+	if err != nil{
+		t.Fatal(err)
+	}
+	client := &http.Client{Timeout: 5 *time.Second, Transport: transport}
+	var pinErr *PinMismatchError
+	if _, err := client.Get(ts.URL); !errors.As(err, &pinErr){
+		t.Fatalf("Expected a *PinMismatchError, Got: %v", err)
+	}
+
+	transport, err = NewTransport(base, map[string][]string{"127.0.0.1": {SPKIPin(ts.Certificate()), otherPin("backup")}})
+	if err != nil{
+		t.Fatal(err)
+	}
+	client = &http.Client{Timeout: 5 *time.Second, Transport: transport}
+	resp, err := client.Get(ts.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil{
+		t.Error("Expected the TLS state of the response")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+type certInfo struct{
+	Subject		string		`json:"subject"`
+	Issuer		string		`json:"issuer"`
+	SANs		[]string	`json:"sans,omitempty"`
+	NotBefore	time.Time	`json:"not_before"`
+	NotAfter	time.Time	`json:"not_after"`
+	DaysLeft	int			`json:"days_left"`
+	KeyType		string		`json:"key_type"`
+	IsCA		bool		`json:"is_ca"`
+}
+
+type report struct{
+	Target		string		`json:"target"`
+	ServerName	string		`json:"server_name"`
+	Version		string		`json:"tls_version,omitempty"`
+	CipherSuite	string		`json:"cipher_suite,omitempty"`
+	ALPN		string		`json:"alpn,omitempty"`
+	OCSPStapled	bool		`json:"ocsp_stapled"`
+	Verified	bool		`json:"verified"`
+	VerifyError	string		`json:"verify_error,omitempty"`
+	// Chain is the chain presented by the server, leaf first.
+	Chain		[]certInfo	`json:"chain,omitempty"`
+	Error		string		`json:"error,omitempty"`
+}
+
+type options struct{
+	// ServerName overrides the SNI, the host of the target by default.
+	ServerName	string
+	// Roots used to verify the chains, the system roots if nil.
+	Roots		*x509.CertPool
+	Timeout		time.Duration
+	Now			func() time.Time
+}
+
+func keyType(cert *x509.Certificate) string{
+	switch k := cert.PublicKey.(type){
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+func sans(cert *x509.Certificate) []string{
+	names := append([]string(nil), cert.DNSNames...)
+	for _, ip := range cert.IPAddresses{
+		names = append(names, ip.String())
+	}
+	names = append(names, cert.EmailAddresses...)
+	for _, u := range cert.URIs{
+		names = append(names, u.String())
+	}
+	return names
+}
+
+func newCertInfo(cert *x509.Certificate, now time.Time) certInfo{
+	return certInfo{
+		Subject:	cert.Subject.String(),
+		Issuer:		cert.Issuer.String(),
+		SANs:		sans(cert),
+		NotBefore:	cert.NotBefore,
+		NotAfter:	cert.NotAfter,
+		DaysLeft:	int(math.Floor(cert.NotAfter.Sub(now).Hours() / 24)),
+		KeyType:	keyType(cert),
+		IsCA:		cert.IsCA,
+	}
+}
+
+// withPort adds :443 to a target without port.
+func withPort(target string) string{
+	if _, _, err := net.SplitHostPort(target); err == nil{
+		return target
+	}
+	return net.JoinHostPort(target, "443")
+}
+
+/*
+	inspect performs a HEAD request to the target and takes the connection
+	state from the TLSHandshakeDone hook, as in connection-pooling.
+	The handshake does not verify the chain, so expired or untrusted
+	certificates are still reported; the chain is verified afterwards and
+	the outcome goes in Verified/VerifyError. The HTTP part may fail (the
+	server may not even speak HTTP), only the handshake matters.
+*/
+func inspect(ctx context.Context, target string, opts options) report{
+	target = withPort(target)
+	host, _, _ := net.SplitHostPort(target)
+	serverName := opts.ServerName
+	if serverName == ""{
+		serverName = host
+	}
+	now := time.Now
+	if opts.Now != nil{
+		now = opts.Now
+	}
+	rep := report{Target: target, ServerName: serverName}
+
+	transport := &http.Transport{
+		TLSClientConfig:	&tls.Config{ServerName: serverName, InsecureSkipVerify: true},
+		ForceAttemptHTTP2:	true,
+		DisableKeepAlives:	true,
+	}
+	defer transport.CloseIdleConnections()
+
+	// the dial may outlive RoundTrip when the context is done, hence the lock
+	var mu sync.Mutex
+	var state *tls.ConnectionState
+	var handshakeErr error
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeDone: func(connState tls.ConnectionState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil{
+				handshakeErr = err
+				return
+			}
+			state = &connState
+		},
+	}
+	if opts.Timeout > 0{
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodHead, "https://"+target+"/", nil)
+	if err != nil{
+		rep.Error = err.Error()
+		return rep
+	}
+	resp, err := transport.RoundTrip(req)
+	if err == nil{
+		resp.Body.Close()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if state == nil{
+		switch{
+		case handshakeErr != nil:
+			rep.Error = handshakeErr.Error()
+		case err != nil:
+			rep.Error = err.Error()
+		default:
+			rep.Error = "no TLS handshake"
+		}
+		return rep
+	}
+
+	rep.Version = tls.VersionName(state.Version)
+	rep.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	rep.ALPN = state.NegotiatedProtocol
+	rep.OCSPStapled = len(state.OCSPResponse) > 0
+	for _, c := range state.PeerCertificates{
+		rep.Chain = append(rep.Chain, newCertInfo(c, now()))
+	}
+
+	if len(state.PeerCertificates) > 0{
+		intermediates := x509.NewCertPool()
+		for _, c := range state.PeerCertificates[1:]{
+			intermediates.AddCert(c)
+		}
+		_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:		serverName,
+			Roots:			opts.Roots,
+			Intermediates:	intermediates,
+			CurrentTime:	now(),
+		})
+		rep.Verified = err == nil
+		if err != nil{
+			rep.VerifyError = err.Error()
+		}
+	}
+	return rep
+}
+
+// expiring reports whether a certificate of r expires in less than days days.
+func (r report) expiring(days int) bool{
+	for _, c := range r.Chain{
+		if c.DaysLeft < days{
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startTestTLSServer() *httptest.Server{
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	return ts
+}
+
+func TestInspect(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+
+	// the httptest certificate is valid for example.com and 127.0.0.1
+	r := inspect(context.Background(), ts.Listener.Addr().String(), options{ServerName: "example.com", Roots: roots, Timeout: 5 *time.Second})
+	if r.Error != ""{
+		t.Fatal(r.Error)
+	}
+	if !r.Verified{
+		t.Errorf("Expected the chain to be verified, Got: %s", r.VerifyError)
+	}
+	if r.Version == "" || r.CipherSuite == "" || r.ALPN != "h2"{
+		t.Errorf("Expected the version, the cipher suite and ALPN h2, Got: %+v", r)
+	}
+	if len(r.Chain) != 1{
+		t.Fatalf("Expected a chain of 1 certificate, Got: %d", len(r.Chain))
+	}
+	leaf := r.Chain[0]
+	if !strings.Contains(strings.Join(leaf.SANs, ","), "example.com") || !strings.HasPrefix(leaf.KeyType, "RSA-"){
+		t.Errorf("Expected the SANs and the key type of the leaf, Got: %+v", leaf)
+	}
+	if leaf.DaysLeft < 365{
+		t.Errorf("Expected the test certificate to be valid for years, Got: %d days", leaf.DaysLeft)
+	}
+}
+
+func TestInspectUntrustedAndExpired(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+
+	// system roots: not trusted, but still reported
+	r := inspect(context.Background(), ts.Listener.Addr().String(), options{Timeout: 5 *time.Second})
+	if r.Error != "" || r.Verified || r.VerifyError == "" || len(r.Chain) == 0{
+		t.Fatalf("Expected an unverified chain with a reason, Got: %+v", r)
+	}
+
+	// a clock far in the future makes the certificate expired
+	future := func() time.Time { return r.Chain[0].NotAfter.Add(48 *time.Hour) }
+	r = inspect(context.Background(), ts.Listener.Addr().String(), options{Timeout: 5 *time.Second, Now: future})
+	if r.Chain[0].DaysLeft >= 0 || !r.expiring(0){
+		t.Errorf("Expected an expired certificate, Got: %d days left", r.Chain[0].DaysLeft)
+	}
+}
+
+func TestExitCode(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+	// nothing listens there once closed
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed := l.Addr().String()
+	l.Close()
+
+	opts := options{Timeout: 5 *time.Second}
+	reports := inspectAll(context.Background(), []string{ts.Listener.Addr().String()}, opts, 2)
+	if code := exitCode(reports, 30); code != 0{
+		t.Errorf("Expected exit code 0, Got: %d", code)
+	}
+	if code := exitCode(reports, 1000000); code != 1{
+		t.Errorf("Expected exit code 1 with a huge threshold, Got: %d", code)
+	}
+
+	reports = inspectAll(context.Background(), []string{ts.Listener.Addr().String(), closed}, opts, 2)
+	if reports[0].Target != ts.Listener.Addr().String() || reports[1].Error == ""{
+		t.Fatalf("Expected the reports in order with an error for %s, Got: %+v", closed, reports)
+	}
+	if code := exitCode(reports, 30); code != 2{
+		t.Errorf("Expected exit code 2, Got: %d", code)
+	}
+}
+
+func TestOutput(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+	reports := inspectAll(context.Background(), []string{ts.Listener.Addr().String()}, options{Timeout: 5 *time.Second}, 1)
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, reports); err != nil{
+		t.Fatal(err)
+	}
+	var decoded []report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil{
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0].Chain[0].Subject != reports[0].Chain[0].Subject{
+		t.Errorf("Expected the JSON to round-trip, Got: %s", buf.String())
+	}
+
+	buf.Reset()
+	writeText(&buf, reports, 1000000)
+	if !strings.Contains(buf.String(), "EXPIRES SOON") || !strings.Contains(buf.String(), "verified: no"){
+		t.Errorf("Expected the warning and the verification status, Got:\n%s", buf.String())
+	}
+}
+
+func TestWithPort(t *testing.T){
+	for in, expected := range map[string]string{
+		"example.com":		"example.com:443",
+		"example.com:8443":	"example.com:8443",
+		"::1":				"[::1]:443",
+	}{
+		if got := withPort(in); got != expected{
+			t.Errorf("Expected %s, Got: %s", expected, got)
+		}
+	}
+}
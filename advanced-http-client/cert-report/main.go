@@ -0,0 +1,194 @@
+/*
+	cert-report connects to TLS servers and reports their certificate chain:
+
+		$ go run . -days 30 example.com registry.internal:8443
+
+		example.com:443  TLS 1.3  TLS_AES_256_GCM_SHA384  ALPN h2  OCSP stapled: no  verified: yes
+		  [0] CN=www.example.org,O=Internet Corporation for Assigned Names and Numbers,...
+		      issuer   CN=DigiCert Global G2 TLS RSA SHA256 2020 CA1,O=DigiCert Inc,C=US
+		      SANs     www.example.org, example.com, ...
+		      valid    2024-01-30 -> 2025-03-01 (70 days left)
+		      key      ECDSA-P-256
+		  ...
+
+	Targets are host:port (443 if omitted), from the arguments and/or a file
+	(-f, one per line, # for comments). -json prints the reports as JSON.
+
+	Exit status: 1 if a certificate of any chain expires within -days, 2 if a
+	target could not be inspected, 0 otherwise. An expired or untrusted chain
+	is still reported (verified: no), it is not an inspection error.
+
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func readTargets(path string) ([]string, error){
+	f, err := os.Open(path)
+	if err != nil{
+		return nil, err
+	}
+	defer f.Close()
+	var targets []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan(){
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#"){
+			continue
+		}
+		targets = append(targets, line)
+	}
+	return targets, scanner.Err()
+}
+
+// inspectAll inspects the targets with at most concurrency handshakes at a time, the reports keep the order of targets.
+func inspectAll(ctx context.Context, targets []string, opts options, concurrency int) []report{
+	reports := make([]report, len(targets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets{
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, target string){
+			defer wg.Done()
+			defer func() { <-sem }()
+			reports[i] = inspect(ctx, target, opts)
+		}(i, target)
+	}
+	wg.Wait()
+	return reports
+}
+
+func yesNo(b bool) string{
+	if b{
+		return "yes"
+	}
+	return "no"
+}
+
+func writeText(w io.Writer, reports []report, days int){
+	for i, r := range reports{
+		if i > 0{
+			fmt.Fprintln(w)
+		}
+		if r.Error != ""{
+			fmt.Fprintf(w, "%s  ERROR: %s\n", r.Target, r.Error)
+			continue
+		}
+		alpn := r.ALPN
+		if alpn == ""{
+			alpn = "-"
+		}
+		fmt.Fprintf(w, "%s  %s  %s  ALPN %s  OCSP stapled: %s  verified: %s\n", r.Target, r.Version, r.CipherSuite, alpn, yesNo(r.OCSPStapled), yesNo(r.Verified))
+		if r.VerifyError != ""{
+			fmt.Fprintf(w, "  verification: %s\n", r.VerifyError)
+		}
+		for j, c := range r.Chain{
+			warn := ""
+			if c.DaysLeft < days{
+				warn = "  <-- EXPIRES SOON"
+			}
+			if c.DaysLeft < 0{
+				warn = "  <-- EXPIRED"
+			}
+			fmt.Fprintf(w, "  [%d] %s\n", j, c.Subject)
+			fmt.Fprintf(w, "      issuer   %s\n", c.Issuer)
+			if len(c.SANs) > 0{
+				fmt.Fprintf(w, "      SANs     %s\n", strings.Join(c.SANs, ", "))
+			}
+			fmt.Fprintf(w, "      valid    %s -> %s (%d days left)%s\n", c.NotBefore.Format("2006-01-02"), c.NotAfter.Format("2006-01-02"), c.DaysLeft, warn)
+			fmt.Fprintf(w, "      key      %s\n", c.KeyType)
+		}
+	}
+}
+
+func writeJSON(w io.Writer, reports []report) error{
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+// exitCode returns 2 if a target failed, 1 if a certificate expires within days, 0 otherwise.
+func exitCode(reports []report, days int) int{
+	code := 0
+	for _, r := range reports{
+		if r.Error != ""{
+			return 2
+		}
+		if r.expiring(days){
+			code = 1
+		}
+	}
+	return code
+}
+
+func loadRoots(path string) (*x509.CertPool, error){
+	data, err := os.ReadFile(path)
+	if err != nil{
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data){
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return pool, nil
+}
+
+func main(){
+	asJSON := flag.Bool("json", false, "print the reports as JSON")
+	days := flag.Int("days", 30, "exit with status 1 if a certificate expires within this many days")
+	file := flag.String("f", "", "file with one target per line")
+	serverName := flag.String("servername", "", "SNI to send, the target host by default")
+	caFile := flag.String("ca", "", "PEM bundle to verify the chains with, instead of the system roots")
+	concurrency := flag.Int("c", 8, "number of targets inspected at the same time")
+	timeout := flag.Duration("timeout", 10 *time.Second, "time-out of each target")
+	flag.Parse()
+
+	targets := flag.Args()
+	if *file != ""{
+		fromFile, err := readTargets(*file)
+		if err != nil{
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		targets = append(targets, fromFile...)
+	}
+	if len(targets) == 0 || *concurrency < 1{
+		fmt.Fprintln(os.Stderr, "Usage: cert-report [-json] [-days n] [-f file] [-servername name] [-ca file] [-c n] [-timeout d] host[:port]...")
+		os.Exit(2)
+	}
+
+	opts := options{ServerName: *serverName, Timeout: *timeout}
+	if *caFile != ""{
+		roots, err := loadRoots(*caFile)
+		if err != nil{
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+		opts.Roots = roots
+	}
+
+	reports := inspectAll(context.Background(), targets, opts, *concurrency)
+	if *asJSON{
+		if err := writeJSON(os.Stdout, reports); err != nil{
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+	}else{
+		writeText(os.Stdout, reports, *days)
+	}
+	os.Exit(exitCode(reports, *days))
+}
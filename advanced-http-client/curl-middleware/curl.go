@@ -0,0 +1,410 @@
+/*
+	When a request fails, the quickest way to find out whether it is our
+	client or the server misbehaving is to replay the exact same request by
+	hand. curl is available almost everywhere, so we render an
+	*http.Request as an equivalent curl command line:
+
+		curl -X POST -H 'Content-Type: application/json' --data-binary '{"name":"mypackage"}' 'http://127.0.0.1/api/packages'
+
+	The command carries the method, the headers, the body, the time-out and
+	the redirect behaviour of the client. Sensitive values (auth headers,
+	cookies, passwords in the URL) are redacted, so the command can be safely
+	pasted into a log or a bug report.
+
+	The body is redacted with the same list as the query parameters: the
+	matching fields of a JSON object (at any depth), of a form and of a
+	multipart message are replaced. A redacted JSON body is re-encoded, its
+	keys then come out sorted. A body of another type is printed as it is,
+	send credentials in the headers or in one of these formats.
+
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The value that replaces anything we are not allowed to print.
+const redactedValue = "REDACTED"
+
+// maxBodySize is the largest body printed on the command line, a longer one is referenced as BodyFile.
+const maxBodySize = 1 << 20
+
+// Headers whose values are never printed. Header names are compared in their canonical form.
+var defaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Auth-Hash",
+	"X-Api-Key",
+}
+
+// Query parameters and body fields whose values are never printed. Names are compared case-insensitively.
+var defaultRedactedParams = []string{
+	"access_token",
+	"api_key",
+	"client_secret",
+	"password",
+	"refresh_token",
+	"secret",
+	"token",
+}
+
+// CurlConfig describes the parts of the client that are not visible on the request itself.
+type CurlConfig struct{
+	// Timeout is rendered as --max-time. Zero means no time-out.
+	Timeout			time.Duration
+	// FollowRedirects adds -L, MaxRedirects (if > 0) adds --max-redirs.
+	FollowRedirects	bool
+	MaxRedirects	int
+	// Extra header names and query parameters (or body fields) to redact, on top of the defaults.
+	RedactHeaders	[]string
+	RedactParams	[]string
+	// BodyFile is referenced as --data-binary @BodyFile when the body is not printable text or is too long.
+	BodyFile		string
+}
+
+// CurlConfigFromClient derives the time-out and redirect flags from an http.Client.
+// A nil CheckRedirect means the default policy: follow up to 10 redirects.
+// A custom policy cannot be expressed with curl flags, so redirects are then left off.
+func CurlConfigFromClient(c *http.Client) CurlConfig{
+	cfg := CurlConfig{}
+	if c == nil{
+		c = http.DefaultClient
+	}
+	cfg.Timeout = c.Timeout
+	if c.CheckRedirect == nil{
+		cfg.FollowRedirects = true
+		cfg.MaxRedirects = 10
+	}
+	return cfg
+}
+
+// CurlCommand renders r as a curl command line, using the default configuration.
+func CurlCommand(r *http.Request) (string, error){
+	return CurlCommandWithConfig(r, CurlConfig{})
+}
+
+// CurlCommandWithConfig renders r as a curl command line.
+// The request body is read through GetBody when available, otherwise its first maxBodySize bytes
+// are read and put back in front of the rest, so r can still be sent after this call.
+func CurlCommandWithConfig(r *http.Request, cfg CurlConfig) (string, error){
+	if r == nil || r.URL == nil{
+		return "", errors.New("curl: request has no URL")
+	}
+
+	body, complete, err := peekBody(r)
+	if err != nil{
+		return "", err
+	}
+	cfg.Timeout = effectiveTimeout(r, cfg.Timeout)
+	return curlCommand(r, cfg, body, complete)
+}
+
+// effectiveTimeout returns the time-out of the client or the deadline of the request context, whichever comes first.
+func effectiveTimeout(r *http.Request, timeout time.Duration) time.Duration{
+	if deadline, ok := r.Context().Deadline(); ok{
+		if d := time.Until(deadline); d > 0 && (timeout == 0 || d < timeout){
+			timeout = d
+		}
+	}
+	return timeout
+}
+
+// curlCommand renders r with body as its body, complete is false if body is only the start of it.
+// cfg.Timeout is used as it is, the request context is not looked at.
+func curlCommand(r *http.Request, cfg CurlConfig, body []byte, complete bool) (string, error){
+	args := []string{"curl"}
+
+	method := r.Method
+	if method == ""{
+		method = http.MethodGet
+	}
+	if method != http.MethodGet{
+		args = append(args, "-X", method)
+	}
+
+	if cfg.FollowRedirects{
+		args = append(args, "-L")
+		if cfg.MaxRedirects > 0{
+			args = append(args, "--max-redirs", fmt.Sprint(cfg.MaxRedirects))
+		}
+	}
+
+	if cfg.Timeout > 0{
+		args = append(args, "--max-time", formatSeconds(cfg.Timeout))
+	}
+
+	// A multipart body is rendered as -F flags, curl then generates its own boundary and Content-Type.
+	// A truncated body can not be parsed, it is left to BodyFile.
+	redactParams := redactedParams(cfg.RedactParams)
+	var formArgs []string
+	var isMultipart bool
+	if complete{
+		var err error
+		formArgs, isMultipart, err = multipartArgs(r.Header.Get("Content-Type"), body, redactParams)
+		if err != nil{
+			return "", err
+		}
+		body = redactBody(r.Header.Get("Content-Type"), body, redactParams)
+	}
+
+	redactHeaders := canonicalSet(defaultRedactedHeaders, cfg.RedactHeaders)
+	if r.Host != "" && r.Host != r.URL.Host{
+		args = append(args, "-H", quote("Host: "+r.Host))
+	}
+	for _, key := range sortedHeaderNames(r.Header){
+		name := http.CanonicalHeaderKey(key)
+		if name == "Content-Length"{
+			continue
+		}
+		if name == "Content-Type" && isMultipart{
+			continue
+		}
+		for _, v := range r.Header[key]{
+			if redactHeaders[name]{
+				v = redactedValue
+			}
+			args = append(args, "-H", quote(name+": "+v))
+		}
+	}
+
+	switch{
+	case isMultipart:
+		args = append(args, formArgs...)
+	case complete && len(body) > 0 && utf8.Valid(body):
+		args = append(args, "--data-binary", quote(string(body)))
+	case len(body) > 0 || !complete:
+		file := cfg.BodyFile
+		if file == ""{
+			file = "request-body.bin"
+		}
+		args = append(args, "--data-binary", quote("@"+file))
+	}
+
+	args = append(args, quote(redactURL(r.URL, cfg.RedactParams)))
+	return strings.Join(args, " "), nil
+}
+
+// peekBody returns up to maxBodySize bytes of the request body without consuming it.
+// complete is false when the body is longer.
+func peekBody(r *http.Request) (body []byte, complete bool, err error){
+	if r.Body == nil || r.Body == http.NoBody{
+		return nil, true, nil
+	}
+	if r.GetBody != nil{
+		rc, err := r.GetBody()
+		if err != nil{
+			return nil, false, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, maxBodySize+1))
+		if err != nil{
+			return nil, false, err
+		}
+		return truncate(data)
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	// put back what was read in front of the rest, so that the request can still be sent
+	r.Body = struct{
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+	if err != nil{
+		return nil, false, err
+	}
+	return truncate(data)
+}
+
+func truncate(data []byte) ([]byte, bool, error){
+	if len(data) > maxBodySize{
+		return data[:maxBodySize], false, nil
+	}
+	return data, true, nil
+}
+
+// multipartArgs turns a multipart/form-data body into --form-string and -F flags.
+// Fields use --form-string so that values starting with @ or < are not interpreted by curl.
+// File parts are rendered as name=@filename, the file is expected in the current directory.
+// The values of the fields in redact are replaced.
+func multipartArgs(contentType string, body []byte, redact map[string]bool) ([]string, bool, error){
+	if contentType == ""{
+		return nil, false, nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == ""{
+		return nil, false, nil
+	}
+
+	var args []string
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for{
+		part, err := mr.NextPart()
+		if err == io.EOF{
+			break
+		}
+		if err != nil{
+			return nil, true, fmt.Errorf("curl: reading multipart body: %w", err)
+		}
+
+		if part.FileName() != ""{
+			v := part.FormName() + "=@" + part.FileName()
+			if ct := part.Header.Get("Content-Type"); ct != "" && ct != "application/octet-stream"{
+				v += ";type=" + ct
+			}
+			args = append(args, "-F", quote(v))
+			continue
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil{
+			return nil, true, fmt.Errorf("curl: reading multipart body: %w", err)
+		}
+		if redact[strings.ToLower(part.FormName())]{
+			value = []byte(redactedValue)
+		}
+		args = append(args, "--form-string", quote(part.FormName()+"="+string(value)))
+	}
+	return args, true, nil
+}
+
+func redactURL(u *url.URL, extraParams []string) string{
+	c := *u
+	if c.User != nil{
+		if _, ok := c.User.Password(); ok{
+			c.User = url.UserPassword(c.User.Username(), redactedValue)
+		}
+	}
+	if c.RawQuery != ""{
+		q := c.Query()
+		redact := redactedParams(extraParams)
+		changed := false
+		for k := range q{
+			if redact[strings.ToLower(k)]{
+				q.Set(k, redactedValue)
+				changed = true
+			}
+		}
+		if changed{
+			c.RawQuery = q.Encode()
+		}
+	}
+	return c.String()
+}
+
+// redactedParams returns the lower-cased names of the default and extra parameters to redact.
+func redactedParams(extra []string) map[string]bool{
+	redact := map[string]bool{}
+	for _, p := range append(append([]string{}, defaultRedactedParams...), extra...){
+		redact[strings.ToLower(p)] = true
+	}
+	return redact
+}
+
+// redactBody replaces the fields in redact of a JSON or form body, other bodies are returned as they are.
+func redactBody(contentType string, body []byte, redact map[string]bool) []byte{
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || len(body) == 0{
+		return body
+	}
+	switch{
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		var v interface{}
+		if dec.Decode(&v) != nil || !redactJSON(v, redact){
+			return body
+		}
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		//keep <, > and & as they were sent
+		enc.SetEscapeHTML(false)
+		if enc.Encode(v) != nil{
+			return body
+		}
+		return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil{
+			return body
+		}
+		changed := false
+		for k := range form{
+			if redact[strings.ToLower(k)]{
+				form.Set(k, redactedValue)
+				changed = true
+			}
+		}
+		if !changed{
+			return body
+		}
+		return []byte(form.Encode())
+	}
+	return body
+}
+
+// redactJSON replaces the values of the keys in redact, at any depth, and reports whether it did.
+func redactJSON(v interface{}, redact map[string]bool) bool{
+	changed := false
+	switch v := v.(type){
+	case map[string]interface{}:
+		for k, child := range v{
+			if redact[strings.ToLower(k)]{
+				v[k] = redactedValue
+				changed = true
+				continue
+			}
+			changed = redactJSON(child, redact) || changed
+		}
+	case []interface{}:
+		for _, child := range v{
+			changed = redactJSON(child, redact) || changed
+		}
+	}
+	return changed
+}
+
+func canonicalSet(lists ...[]string) map[string]bool{
+	s := map[string]bool{}
+	for _, l := range lists{
+		for _, h := range l{
+			s[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+	return s
+}
+
+func sortedHeaderNames(h http.Header) []string{
+	names := make([]string, 0, len(h))
+	for k := range h{
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// formatSeconds prints a duration the way --max-time expects it: seconds, fractions allowed.
+func formatSeconds(d time.Duration) string{
+	s := fmt.Sprintf("%.3f", d.Seconds())
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// quote wraps s in single quotes for a POSIX shell. A single quote inside s becomes '\''
+func quote(s string) string{
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
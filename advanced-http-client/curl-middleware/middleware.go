@@ -0,0 +1,133 @@
+/*
+	The middleware wraps a RoundTripper the same way LoggingClient and
+	AddHeadersMiddleware do. The command is only rendered once we know it
+	will be logged, after the response came back. By then the transport has
+	consumed the body: it is read again through GetBody when the request
+	has one, otherwise the first maxBodySize bytes are recorded while the
+	transport sends them. A body that was not sent in full, or is longer,
+	is referenced as BodyFile.
+
+	With OnlyOnFailure set, the command is logged only when the round trip
+	returned an error or the server answered with a 4xx/5xx status, so a
+	healthy client stays quiet: a successful request costs at most the
+	recorded bytes, no command is rendered.
+
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type CurlLoggingMiddleware struct{
+	// Transport is the RoundTripper that actually sends the request, http.DefaultTransport if nil.
+	Transport		http.RoundTripper
+	Log				*log.Logger
+	Config			CurlConfig
+	OnlyOnFailure	bool
+}
+
+func (c CurlLoggingMiddleware) RoundTrip(r *http.Request)(*http.Response, error){
+	transport := c.Transport
+	if transport == nil{
+		transport = http.DefaultTransport
+	}
+
+	if c.Log == nil{
+		return transport.RoundTrip(r)
+	}
+
+	// the time-out as it is before sending, the deadline of the context gets closer meanwhile
+	cfg := c.Config
+	cfg.Timeout = effectiveTimeout(r, cfg.Timeout)
+	// never modify the caller's request, the body is wrapped to record it
+	reqCopy := r.Clone(r.Context())
+	var rec *recordingBody
+	if reqCopy.GetBody == nil && reqCopy.Body != nil && reqCopy.Body != http.NoBody{
+		rec = &recordingBody{ReadCloser: reqCopy.Body}
+		reqCopy.Body = rec
+	}
+
+	resp, err := transport.RoundTrip(reqCopy)
+
+	failed := err != nil || resp.StatusCode >= http.StatusBadRequest
+	if c.OnlyOnFailure && !failed{
+		return resp, err
+	}
+
+	var cmd string
+	var cmdErr error
+	//the deadline is already in cfg
+	renderReq := reqCopy.WithContext(context.Background())
+	if rec != nil{
+		body, complete := rec.recorded()
+		cmd, cmdErr = curlCommand(renderReq, cfg, body, complete)
+	}else{
+		var body []byte
+		var complete bool
+		body, complete, cmdErr = peekBody(renderReq)
+		if cmdErr == nil{
+			cmd, cmdErr = curlCommand(renderReq, cfg, body, complete)
+		}
+	}
+	switch{
+	case cmdErr != nil:
+		c.Log.Printf("Could not render curl command for %s %s: %v\n", r.Method, r.URL, cmdErr)
+	case err != nil:
+		c.Log.Printf("Request failed with error: %v, reproduce with:\n%s\n", err, cmd)
+	default:
+		c.Log.Printf("Got back %s, reproduce with:\n%s\n", resp.Status, cmd)
+	}
+	return resp, err
+}
+
+// createClientWithCurlLogging returns a client that logs a curl command for every failed request.
+func createClientWithCurlLogging(d time.Duration, l *log.Logger) *http.Client{
+	client := http.Client{Timeout: d}
+	cfg := CurlConfigFromClient(&client)
+	client.Transport = &CurlLoggingMiddleware{
+		Log:			l,
+		Config:			cfg,
+		OnlyOnFailure:	true,
+	}
+	return &client
+}
+
+// recordingBody keeps the first maxBodySize bytes read from the body.
+type recordingBody struct{
+	io.ReadCloser
+	mu			sync.Mutex
+	buf			bytes.Buffer
+	overflow	bool
+	eof			bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error){
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := maxBodySize - b.buf.Len(); n > room{
+		b.buf.Write(p[:room])
+		b.overflow = true
+	}else{
+		b.buf.Write(p[:n])
+	}
+	if err == io.EOF{
+		b.eof = true
+	}
+	return n, err
+}
+
+// recorded returns the bytes read so far, complete is true if they are the whole body.
+func (b *recordingBody) recorded() ([]byte, bool){
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes(), b.eof && !b.overflow
+}
@@ -0,0 +1,189 @@
+/*
+	The Dialer replaces the Transport's DialContext. Before resolving a
+	name it checks, in this order:
+
+		1. static overrides, curl style (curl --resolve host:port:addr):
+
+			registry.example.com:443:127.0.0.1
+			registry.example.com:*:127.0.0.1,::1	(any port, our extension)
+
+		2. a hosts-file style mapping:
+
+			127.0.0.1   registry.example.com  packages.example.com
+			# comments and blank lines are ignored
+
+		3. the Resolver (a CachingResolver, or net.DefaultResolver).
+
+	The first two let us point production hostnames at a local test server
+	without touching /etc/hosts. Only the address changes: the URL, the Host
+	header and the TLS server name stay the same.
+
+*/
+
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"time"
+)
+
+// Override maps host:port to fixed addresses. Port "*" matches any port.
+type Override struct{
+	Host	string
+	Port	string
+	Addrs	[]string
+}
+
+// ParseOverride parses a curl --resolve entry: host:port:addr[,addr...]
+// IPv6 addresses may be written in brackets: host:443:[::1]
+func ParseOverride(s string) (Override, error){
+	o := Override{}
+	host, rest, ok := strings.Cut(s, ":")
+	if !ok{
+		return o, fmt.Errorf("invalid override %q, expected host:port:addr", s)
+	}
+	port, addrs, ok := strings.Cut(rest, ":")
+	if !ok || host == "" || port == "" || addrs == ""{
+		return o, fmt.Errorf("invalid override %q, expected host:port:addr", s)
+	}
+	o.Host = strings.ToLower(host)
+	o.Port = port
+	for _, a := range strings.Split(addrs, ","){
+		a = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(a), "["), "]")
+		if net.ParseIP(a) == nil{
+			return o, fmt.Errorf("invalid override %q: %q is not an IP address", s, a)
+		}
+		o.Addrs = append(o.Addrs, a)
+	}
+	return o, nil
+}
+
+// ParseHostsFile reads a hosts-file style mapping: an address followed by one or more names per line.
+func ParseHostsFile(r io.Reader) (map[string][]string, error){
+	hosts := map[string][]string{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan(){
+		lineNo++
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0{
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0{
+			continue
+		}
+		if len(fields) < 2 || net.ParseIP(fields[0]) == nil{
+			return nil, fmt.Errorf("hosts file line %d: expected an address followed by host names", lineNo)
+		}
+		for _, name := range fields[1:]{
+			name = strings.ToLower(name)
+			hosts[name] = append(hosts[name], fields[0])
+		}
+	}
+	return hosts, scanner.Err()
+}
+
+func LoadHostsFile(path string) (map[string][]string, error){
+	f, err := os.Open(path)
+	if err != nil{
+		return nil, err
+	}
+	defer f.Close()
+	return ParseHostsFile(f)
+}
+
+type Dialer struct{
+	Overrides	[]Override
+	Hosts		map[string][]string
+	// Resolver is used for the names not overridden, net.DefaultResolver if nil.
+	Resolver	Resolver
+	// Dialer opens the connections to the resolved addresses.
+	Dialer		*net.Dialer
+}
+
+// lookup returns the addresses of host for a connection to port.
+func (d *Dialer) lookup(ctx context.Context, host, port string) ([]string, error){
+	host = strings.ToLower(host)
+	for _, o := range d.Overrides{
+		if o.Host == host && (o.Port == port || o.Port == "*"){
+			return o.Addrs, nil
+		}
+	}
+	if addrs, ok := d.Hosts[host]; ok{
+		return addrs, nil
+	}
+
+	var r Resolver = net.DefaultResolver
+	if d.Resolver != nil{
+		r = d.Resolver
+	}
+	// we resolve the name ourselves, so the net package will not report it to httptrace
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil{
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	addrs, err := r.LookupHost(ctx, host)
+	if trace != nil && trace.DNSDone != nil{
+		info := httptrace.DNSDoneInfo{Err: err}
+		for _, a := range addrs{
+			info.Addrs = append(info.Addrs, net.IPAddr{IP: net.ParseIP(a)})
+		}
+		trace.DNSDone(info)
+	}
+	return addrs, err
+}
+
+// DialContext has the signature expected by http.Transport.DialContext.
+// The addresses are tried in order until one accepts the connection.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error){
+	host, port, err := net.SplitHostPort(address)
+	if err != nil{
+		return nil, err
+	}
+	dialer := d.Dialer
+	if dialer == nil{
+		dialer = &net.Dialer{Timeout: 30 *time.Second, KeepAlive: 30 *time.Second}
+	}
+	if net.ParseIP(host) != nil{
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := d.lookup(ctx, host, port)
+	if err != nil{
+		return nil, err
+	}
+	if len(addrs) == 0{
+		return nil, &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+
+	var errs []error
+	for _, a := range addrs{
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(a, port))
+		if err == nil{
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil{
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// createClientWithDialer returns a client whose connections are opened through d.
+func createClientWithDialer(timeout time.Duration, d *Dialer) *http.Client{
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = d.DialContext
+	client := http.Client{Timeout: timeout, Transport: transport}
+	return &client
+}
@@ -0,0 +1,157 @@
+/*
+	connection-pooling prints the DNSDone event, but the client has no say in
+	how names are resolved: the Transport's dialer asks the system resolver
+	every time a new connection is needed. Under a high request rate with
+	short-lived connections that is a lot of DNS queries.
+
+	CachingResolver sits in front of any Resolver (net.DefaultResolver by
+	default) and keeps the answers for a fixed TTL. The Go resolver does not
+	tell us the TTL of the records, so it is configured by the caller.
+	"No such host" answers are cached too (negative caching), but for a
+	shorter time; temporary errors such as time-outs are never cached.
+
+	Concurrent lookups of the same name are merged into one query. The
+	query belongs to none of the callers: it runs in its own goroutine and
+	is only cancelled once every caller waiting for it gave up, its
+	(cancelled) answer is then not cached and the next caller starts over.
+
+*/
+
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Resolver is the part of *net.Resolver we need, so net.DefaultResolver can be used as is.
+type Resolver interface{
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type cacheEntry struct{
+	addrs	[]string
+	err		error
+	expires	time.Time
+}
+
+// inflight is a lookup in progress, the other callers wait for it instead of querying again.
+type inflight struct{
+	done	chan struct{}
+	addrs	[]string
+	err		error
+	// waiters is the number of callers still waiting, guarded by CachingResolver.mu.
+	waiters	int
+	cancel	context.CancelFunc
+}
+
+type CachingResolver struct{
+	// Upstream does the actual lookups, net.DefaultResolver if nil.
+	Upstream	Resolver
+	// TTL is how long an answer is kept.
+	TTL			time.Duration
+	// NegativeTTL is how long a "no such host" answer is kept, 0 disables negative caching.
+	NegativeTTL	time.Duration
+
+	// now is replaced in the tests.
+	now		func() time.Time
+
+	mu			sync.Mutex
+	entries		map[string]cacheEntry
+	inflight	map[string]*inflight
+}
+
+func NewCachingResolver(upstream Resolver, ttl, negativeTTL time.Duration) *CachingResolver{
+	return &CachingResolver{Upstream: upstream, TTL: ttl, NegativeTTL: negativeTTL}
+}
+
+func (c *CachingResolver) clock() time.Time{
+	if c.now != nil{
+		return c.now()
+	}
+	return time.Now()
+}
+
+func (c *CachingResolver) LookupHost(ctx context.Context, host string) ([]string, error){
+	c.mu.Lock()
+	if c.entries == nil{
+		c.entries = map[string]cacheEntry{}
+		c.inflight = map[string]*inflight{}
+	}
+	if e, ok := c.entries[host]; ok{
+		if c.clock().Before(e.expires){
+			c.mu.Unlock()
+			return append([]string(nil), e.addrs...), e.err
+		}
+		delete(c.entries, host)
+	}
+	call, ok := c.inflight[host]
+	if !ok{
+		call = c.startLookup(ctx, host)
+	}
+	call.waiters++
+	c.mu.Unlock()
+
+	select{
+	case <-call.done:
+		return append([]string(nil), call.addrs...), call.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 && c.inflight[host] == call{
+			//nobody wants the answer any more
+			delete(c.inflight, host)
+			call.cancel()
+		}
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// startLookup queries upstream in a goroutine, c.mu must be held.
+func (c *CachingResolver) startLookup(ctx context.Context, host string) *inflight{
+	// the lookup is shared, so it must not be cancelled because the first caller gave up
+	lookupCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	call := &inflight{done: make(chan struct{}), cancel: cancel}
+	c.inflight[host] = call
+
+	upstream := c.Upstream
+	if upstream == nil{
+		upstream = net.DefaultResolver
+	}
+	go func(){
+		defer cancel()
+		call.addrs, call.err = upstream.LookupHost(lookupCtx, host)
+
+		c.mu.Lock()
+		//a cancelled lookup was already removed, a new one may be in its place
+		if c.inflight[host] == call{
+			delete(c.inflight, host)
+			now := c.clock()
+			switch{
+			case call.err == nil && c.TTL > 0:
+				c.entries[host] = cacheEntry{addrs: call.addrs, expires: now.Add(c.TTL)}
+			case isNotFound(call.err) && c.NegativeTTL > 0:
+				c.entries[host] = cacheEntry{err: call.err, expires: now.Add(c.NegativeTTL)}
+			}
+		}
+		c.mu.Unlock()
+		close(call.done)
+	}()
+	return call
+}
+
+// Flush drops every cached answer.
+func (c *CachingResolver) Flush(){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]cacheEntry{}
+}
+
+func isNotFound(err error) bool{
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,237 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingResolver answers from a fixed map and counts the queries.
+type countingResolver struct{
+	calls	atomic.Int64
+	answers	map[string][]string
+	delay	time.Duration
+}
+
+func (r *countingResolver) LookupHost(ctx context.Context, host string) ([]string, error){
+	r.calls.Add(1)
+	time.Sleep(r.delay)
+	if addrs, ok := r.answers[host]; ok{
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestCachingResolver(t *testing.T){
+	upstream := &countingResolver{answers: map[string][]string{"registry.example.com": {"10.0.0.1"}}}
+	c := NewCachingResolver(upstream, time.Minute, 10 *time.Second)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++{
+		addrs, err := c.LookupHost(context.Background(), "registry.example.com")
+		if err != nil || len(addrs) != 1 || addrs[0] != "10.0.0.1"{
+			t.Fatalf("Expected [10.0.0.1], Got: %v, %v", addrs, err)
+		}
+	}
+	if upstream.calls.Load() != 1{
+		t.Fatalf("Expected 1 upstream query, Got: %d", upstream.calls.Load())
+	}
+
+	// negative answers are cached for the shorter TTL
+	for i := 0; i < 2; i++{
+		if _, err := c.LookupHost(context.Background(), "missing.example.com"); !isNotFound(err){
+			t.Fatalf("Expected a not found error, Got: %v", err)
+		}
+	}
+	if upstream.calls.Load() != 2{
+		t.Fatalf("Expected 2 upstream queries, Got: %d", upstream.calls.Load())
+	}
+
+	now = now.Add(11 *time.Second)
+	c.LookupHost(context.Background(), "missing.example.com")
+	c.LookupHost(context.Background(), "registry.example.com")
+	if upstream.calls.Load() != 3{
+		t.Fatalf("Expected the negative entry only to expire, Got: %d upstream queries", upstream.calls.Load())
+	}
+
+	now = now.Add(time.Minute)
+	c.LookupHost(context.Background(), "registry.example.com")
+	if upstream.calls.Load() != 4{
+		t.Fatalf("Expected the positive entry to expire, Got: %d upstream queries", upstream.calls.Load())
+	}
+}
+
+func TestCachingResolverMergesConcurrentLookups(t *testing.T){
+	upstream := &countingResolver{answers: map[string][]string{"registry.example.com": {"10.0.0.1"}}, delay: 50 *time.Millisecond}
+	c := NewCachingResolver(upstream, time.Minute, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++{
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			c.LookupHost(context.Background(), "registry.example.com")
+		}()
+	}
+	wg.Wait()
+	if upstream.calls.Load() != 1{
+		t.Fatalf("Expected 1 upstream query, Got: %d", upstream.calls.Load())
+	}
+}
+
+// blockingResolver blocks every lookup until its context is done, and reports it on cancelled.
+type blockingResolver struct{
+	started		chan struct{}
+	cancelled	chan struct{}
+}
+
+func (r *blockingResolver) LookupHost(ctx context.Context, host string) ([]string, error){
+	r.started <- struct{}{}
+	<-ctx.Done()
+	close(r.cancelled)
+	return nil, ctx.Err()
+}
+
+func TestCachingResolverCancelsAbandonedLookup(t *testing.T){
+	upstream := &blockingResolver{started: make(chan struct{}, 1), cancelled: make(chan struct{})}
+	c := NewCachingResolver(upstream, time.Minute, 0)
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func(){
+		_, err := c.LookupHost(ctx1, "registry.example.com")
+		errs <- err
+	}()
+	<-upstream.started
+	go func(){
+		_, err := c.LookupHost(ctx2, "registry.example.com")
+		errs <- err
+	}()
+	// wait for the second caller to join the lookup
+	for{
+		c.mu.Lock()
+		waiters := c.inflight["registry.example.com"].waiters
+		c.mu.Unlock()
+		if waiters == 2{
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the second caller still waits, the lookup goes on
+	cancel1()
+	<-errs
+	select{
+	case <-upstream.cancelled:
+		t.Fatal("Expected the lookup to go on while a caller waits for it")
+	case <-time.After(50 *time.Millisecond):
+	}
+
+	cancel2()
+	<-errs
+	select{
+	case <-upstream.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the lookup to be cancelled once every caller gave up")
+	}
+}
+
+func TestParseOverride(t *testing.T){
+	o, err := ParseOverride("Registry.example.com:443:127.0.0.1,[::1]")
+	if err != nil{
+		t.Fatal(err)
+	}
+	if o.Host != "registry.example.com" || o.Port != "443" || len(o.Addrs) != 2 || o.Addrs[1] != "::1"{
+		t.Fatalf("Unexpected override: %+v", o)
+	}
+	for _, s := range []string{"registry.example.com", "registry.example.com:443", "registry.example.com:443:not-an-ip"}{
+		if _, err := ParseOverride(s); err == nil{
+			t.Errorf("Expected error for override %q, Got nil", s)
+		}
+	}
+}
+
+func startTestHTTPServer() (*httptest.Server, string){
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Hello %s", r.Host)
+	}))
+	u, _ := url.Parse(ts.URL)
+	return ts, u.Port()
+}
+
+func get(t *testing.T, client *http.Client, url string) string{
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestDialerOverride(t *testing.T){
+	ts, port := startTestHTTPServer()
+	defer ts.Close()
+
+	o, err := ParseOverride("registry.example.com:" + port + ":127.0.0.1")
+	if err != nil{
+		t.Fatal(err)
+	}
+	// the resolver must not be asked for an overridden name
+	upstream := &countingResolver{}
+	client := createClientWithDialer(5 *time.Second, &Dialer{Overrides: []Override{o}, Resolver: upstream})
+
+	body := get(t, client, "http://registry.example.com:"+port+"/api/packages")
+	if body != "Hello registry.example.com:"+port{
+		t.Errorf("Expected the Host header to be kept, Got: %s", body)
+	}
+	if upstream.calls.Load() != 0{
+		t.Errorf("Expected no DNS query, Got: %d", upstream.calls.Load())
+	}
+}
+
+func TestDialerHostsFileAndResolver(t *testing.T){
+	ts, port := startTestHTTPServer()
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "hosts")
+	os.WriteFile(path, []byte("# test mapping\n127.0.0.1  packages.example.com\n"), 0o644)
+	hosts, err := LoadHostsFile(path)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	upstream := &countingResolver{answers: map[string][]string{"cached.example.com": {"127.0.0.1"}}}
+	d := &Dialer{Hosts: hosts, Resolver: NewCachingResolver(upstream, time.Minute, 0)}
+	// no keep-alives, so every request dials again
+	transport := &http.Transport{DialContext: d.DialContext, DisableKeepAlives: true}
+	client := &http.Client{Timeout: 5 *time.Second, Transport: transport}
+
+	if body := get(t, client, "http://packages.example.com:"+port); !strings.HasPrefix(body, "Hello packages.example.com"){
+		t.Errorf("Unexpected response: %s", body)
+	}
+	get(t, client, "http://cached.example.com:"+port)
+	get(t, client, "http://cached.example.com:"+port)
+	if upstream.calls.Load() != 1{
+		t.Errorf("Expected 1 DNS query thanks to the cache, Got: %d", upstream.calls.Load())
+	}
+
+	_, err = client.Get("http://missing.example.com:" + port)
+	if err == nil || !isNotFound(err){
+		t.Errorf("Expected a not found error, Got: %v", err)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/Praveen005/Go-http-client/tree/main/advanced-http-client/httpstat
+
+go 1.21.2
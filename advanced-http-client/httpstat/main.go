@@ -0,0 +1,209 @@
+/*
+	httpstat performs a GET request and prints where the time went:
+
+		$ go run . -n 3 https://example.com
+
+		Connected to 93.184.216.34:443 over HTTP/2.0, TLS 1.3 TLS_AES_128_GCM_SHA256 (ALPN: h2)
+
+		  DNS Lookup     TCP Connection   TLS Handshake   Server Processing   Content Transfer
+		[     4ms      |      92ms      |     190ms     |       96ms        |       1ms        ]
+
+	With -n > 1 the request is repeated (on a new connection every time,
+	unless -keepalive is set) and min/median/max are printed for each phase.
+	-json prints every run and the summary as JSON, for scripts.
+
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// phaseSummary is the min/median/max of one phase over all the runs.
+type phaseSummary struct{
+	Min		time.Duration
+	Median	time.Duration
+	Max		time.Duration
+}
+
+func summarize(values []time.Duration) phaseSummary{
+	if len(values) == 0{
+		return phaseSummary{}
+	}
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0{
+		median = (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	}
+	return phaseSummary{Min: sorted[0], Median: median, Max: sorted[len(sorted)-1]}
+}
+
+// summarizeRuns returns the summary of every phase, plus "Total".
+func summarizeRuns(results []result) map[string]phaseSummary{
+	s := map[string]phaseSummary{}
+	names := append(append([]string(nil), phaseNames...), "Total")
+	for _, name := range names{
+		var values []time.Duration
+		for _, r := range results{
+			if name == "Total"{
+				values = append(values, r.Total)
+			}else{
+				values = append(values, r.Phases[name])
+			}
+		}
+		s[name] = summarize(values)
+	}
+	return s
+}
+
+func ms(d time.Duration) float64{
+	return float64(d.Microseconds()) / 1000
+}
+
+func fmtMs(d time.Duration) string{
+	return fmt.Sprintf("%dms", d.Round(time.Millisecond).Milliseconds())
+}
+
+func center(s string, width int) string{
+	if len(s) >= width{
+		return s
+	}
+	left := (width - len(s)) / 2
+	return strings.Repeat(" ", left) + s + strings.Repeat(" ", width-len(s)-left)
+}
+
+func writeText(w io.Writer, results []result){
+	first := results[0]
+	conn := fmt.Sprintf("Connected to %s over %s", first.RemoteAddr, first.Proto)
+	if first.TLSVersion != ""{
+		conn += fmt.Sprintf(", %s %s", first.TLSVersion, first.TLSCipher)
+	}
+	if first.ALPN != ""{
+		conn += fmt.Sprintf(" (ALPN: %s)", first.ALPN)
+	}
+	fmt.Fprintf(w, "%s\n", conn)
+	fmt.Fprintf(w, "Status: %d, %d bytes\n\n", first.Status, first.BodySize)
+
+	widths := make([]int, len(phaseNames))
+	var header []string
+	for i, name := range phaseNames{
+		widths[i] = len(name) + 4
+		header = append(header, center(name, widths[i]))
+	}
+	fmt.Fprintf(w, " %s\n", strings.Join(header, " "))
+
+	row := func(get func(name string) time.Duration) string{
+		var cells []string
+		for i, name := range phaseNames{
+			cells = append(cells, center(fmtMs(get(name)), widths[i]))
+		}
+		return "[" + strings.Join(cells, "|") + "]"
+	}
+
+	if len(results) == 1{
+		fmt.Fprintf(w, "%s\n", row(func(name string) time.Duration { return first.Phases[name] }))
+		fmt.Fprintf(w, "\nTotal: %s\n", fmtMs(first.Total))
+		return
+	}
+
+	s := summarizeRuns(results)
+	fmt.Fprintf(w, "%s min\n", row(func(name string) time.Duration { return s[name].Min }))
+	fmt.Fprintf(w, "%s median\n", row(func(name string) time.Duration { return s[name].Median }))
+	fmt.Fprintf(w, "%s max\n", row(func(name string) time.Duration { return s[name].Max }))
+	fmt.Fprintf(w, "\nTotal over %d runs: min %s, median %s, max %s\n", len(results), fmtMs(s["Total"].Min), fmtMs(s["Total"].Median), fmtMs(s["Total"].Max))
+}
+
+// The JSON output uses milliseconds, like the text output.
+type jsonRun struct{
+	result
+	PhasesMs	map[string]float64	`json:"phases_ms"`
+	TotalMs		float64				`json:"total_ms"`
+}
+
+type jsonSummary struct{
+	MinMs		float64	`json:"min_ms"`
+	MedianMs	float64	`json:"median_ms"`
+	MaxMs		float64	`json:"max_ms"`
+}
+
+type jsonOutput struct{
+	Runs	[]jsonRun				`json:"runs"`
+	Summary	map[string]jsonSummary	`json:"summary"`
+}
+
+func writeJSON(w io.Writer, results []result) error{
+	out := jsonOutput{Summary: map[string]jsonSummary{}}
+	for _, r := range results{
+		run := jsonRun{result: r, PhasesMs: map[string]float64{}, TotalMs: ms(r.Total)}
+		for name, d := range r.Phases{
+			run.PhasesMs[name] = ms(d)
+		}
+		out.Runs = append(out.Runs, run)
+	}
+	for name, s := range summarizeRuns(results){
+		out.Summary[name] = jsonSummary{MinMs: ms(s.Min), MedianMs: ms(s.Median), MaxMs: ms(s.Max)}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+func createHTTPClient(d time.Duration, keepAlive bool) *http.Client{
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a fresh connection for every run, otherwise only the first one shows DNS/TCP/TLS
+	transport.DisableKeepAlives = !keepAlive
+	client := http.Client{Timeout: d, Transport: transport}
+	return &client
+}
+
+func run(ctx context.Context, client *http.Client, url string, n int) ([]result, error){
+	var results []result
+	for i := 0; i < n; i++{
+		r, err := measure(ctx, client, url)
+		if err != nil{
+			return results, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func main(){
+	n := flag.Int("n", 1, "number of requests to make")
+	asJSON := flag.Bool("json", false, "print the results as JSON")
+	keepAlive := flag.Bool("keepalive", false, "reuse the connection between runs")
+	timeout := flag.Duration("timeout", 15 *time.Second, "time-out of each request")
+	flag.Parse()
+
+	if flag.NArg() != 1 || *n < 1{
+		fmt.Fprintln(os.Stderr, "Usage: httpstat [-n runs] [-json] [-keepalive] [-timeout d] URL")
+		os.Exit(1)
+	}
+
+	client := createHTTPClient(*timeout, *keepAlive)
+	results, err := run(context.Background(), client, flag.Arg(0), *n)
+	if err != nil{
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	if *asJSON{
+		if err := writeJSON(os.Stdout, results); err != nil{
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	writeText(os.Stdout, results)
+}
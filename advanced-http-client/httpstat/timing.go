@@ -0,0 +1,178 @@
+/*
+	createHTTPGetRequestWithTrace in connection-pooling prints the httptrace
+	events as they happen. Here we record the time of each event instead, and
+	turn them into the phases of a request:
+
+		DNS Lookup          DNSStart -> DNSDone
+		TCP Connection      ConnectStart -> ConnectDone
+		TLS Handshake       TLSHandshakeStart -> TLSHandshakeDone
+		Server Processing   WroteRequest -> GotFirstResponseByte (time to first byte)
+		Content Transfer    GotFirstResponseByte -> body read to EOF
+
+	When a pooled connection is reused, the first three phases simply do not
+	happen and are reported as zero.
+
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// timings holds the time of every event we are interested in.
+type timings struct{
+	mu				sync.Mutex
+	start			time.Time
+	dnsStart		time.Time
+	dnsDone			time.Time
+	connectStart	time.Time
+	connectDone		time.Time
+	tlsStart		time.Time
+	tlsDone			time.Time
+	gotConn			time.Time
+	wroteRequest	time.Time
+	firstByte		time.Time
+	bodyDone		time.Time
+
+	reused			bool
+	remoteAddr		string
+	tlsState		*tls.ConnectionState
+}
+
+// set records the current time in field. With happy eyeballs the connect events
+// can fire more than once, so a start keeps its first value and a done its last.
+func (t *timings) set(field *time.Time){
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	isDone := field == &t.dnsDone || field == &t.connectDone
+	if field.IsZero() || isDone{
+		*field = time.Now()
+	}
+}
+
+func createHTTPGetRequestWithTimings(ctx context.Context, url string, t *timings)(*http.Request, error){
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil{
+		return nil, err
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.set(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.set(&t.dnsDone)
+		},
+		ConnectStart: func(network, addr string) {
+			t.set(&t.connectStart)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.set(&t.connectDone)
+		},
+		TLSHandshakeStart: func() {
+			t.set(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(connState tls.ConnectionState, err error) {
+			t.set(&t.tlsDone)
+			t.mu.Lock()
+			t.tlsState = &connState
+			t.mu.Unlock()
+		},
+		GotConn: func(connInfo httptrace.GotConnInfo) {
+			t.set(&t.gotConn)
+			t.mu.Lock()
+			t.reused = connInfo.Reused
+			t.remoteAddr = connInfo.Conn.RemoteAddr().String()
+			t.mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.set(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			t.set(&t.firstByte)
+		},
+	}
+	ctxTrace := httptrace.WithClientTrace(req.Context(), trace)
+	return req.WithContext(ctxTrace), nil
+}
+
+// Phases of a request, in the order they happen.
+var phaseNames = []string{"DNS Lookup", "TCP Connection", "TLS Handshake", "Server Processing", "Content Transfer"}
+
+// result is the outcome of one measured request.
+type result struct{
+	URL				string				`json:"url"`
+	Status			int					`json:"status"`
+	Proto			string				`json:"proto"`
+	RemoteAddr		string				`json:"remote_addr"`
+	Reused			bool				`json:"reused"`
+	TLSVersion		string				`json:"tls_version,omitempty"`
+	TLSCipher		string				`json:"tls_cipher,omitempty"`
+	ALPN			string				`json:"alpn,omitempty"`
+	BodySize		int64				`json:"body_size"`
+	// Phases are keyed by the names in phaseNames, the JSON output converts them to milliseconds.
+	Phases			map[string]time.Duration	`json:"-"`
+	Total			time.Duration		`json:"-"`
+}
+
+func between(from, to time.Time) time.Duration{
+	if from.IsZero() || to.IsZero() || to.Before(from){
+		return 0
+	}
+	return to.Sub(from)
+}
+
+// measure performs one GET request and returns its timing breakdown.
+func measure(ctx context.Context, client *http.Client, url string) (result, error){
+	t := &timings{}
+	req, err := createHTTPGetRequestWithTimings(ctx, url, t)
+	if err != nil{
+		return result{}, err
+	}
+
+	t.start = time.Now()
+	resp, err := client.Do(req)
+	if err != nil{
+		return result{}, err
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil{
+		return result{}, err
+	}
+	t.set(&t.bodyDone)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := result{
+		URL:		url,
+		Status:		resp.StatusCode,
+		Proto:		resp.Proto,
+		RemoteAddr:	t.remoteAddr,
+		Reused:		t.reused,
+		BodySize:	n,
+		Phases: map[string]time.Duration{
+			"DNS Lookup":			between(t.dnsStart, t.dnsDone),
+			"TCP Connection":		between(t.connectStart, t.connectDone),
+			"TLS Handshake":		between(t.tlsStart, t.tlsDone),
+			"Server Processing":	between(t.wroteRequest, t.firstByte),
+			"Content Transfer":		between(t.firstByte, t.bodyDone),
+		},
+		Total:		between(t.start, t.bodyDone),
+	}
+	if resp.TLS != nil{
+		r.TLSVersion = tls.VersionName(resp.TLS.Version)
+		r.TLSCipher = tls.CipherSuiteName(resp.TLS.CipherSuite)
+		r.ALPN = resp.TLS.NegotiatedProtocol
+	}else if t.tlsState != nil{
+		r.TLSVersion = tls.VersionName(t.tlsState.Version)
+		r.TLSCipher = tls.CipherSuiteName(t.tlsState.CipherSuite)
+	}
+	return r, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startTestTLSServer() *httptest.Server{
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 *time.Millisecond) // some server processing time
+		fmt.Fprint(w, "Hello World")
+	}))
+	return ts
+}
+
+// testClient trusts the test server certificate, with or without keep-alives.
+func testClient(ts *httptest.Server, keepAlive bool) *http.Client{
+	transport := ts.Client().Transport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = !keepAlive
+	return &http.Client{Timeout: 5 *time.Second, Transport: transport}
+}
+
+func TestMeasureTLS(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+
+	r, err := measure(context.Background(), testClient(ts, false), ts.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if r.Status != 200 || r.BodySize != 11{
+		t.Errorf("Expected status 200 with 11 bytes, Got: %d with %d bytes", r.Status, r.BodySize)
+	}
+	if r.TLSVersion == "" || r.TLSCipher == ""{
+		t.Errorf("Expected TLS version and cipher to be reported, Got: %q %q", r.TLSVersion, r.TLSCipher)
+	}
+	if r.RemoteAddr != ts.Listener.Addr().String(){
+		t.Errorf("Expected remote address %s, Got: %s", ts.Listener.Addr(), r.RemoteAddr)
+	}
+	for _, name := range []string{"TCP Connection", "TLS Handshake"}{
+		if r.Phases[name] <= 0{
+			t.Errorf("Expected %s to take some time, Got: %s", name, r.Phases[name])
+		}
+	}
+	if r.Phases["Server Processing"] < 10 *time.Millisecond{
+		t.Errorf("Expected server processing to take at least 10ms, Got: %s", r.Phases["Server Processing"])
+	}
+	if r.Total < r.Phases["Server Processing"]{
+		t.Errorf("Expected total %s to be at least the server processing time", r.Total)
+	}
+}
+
+func TestRunKeepAliveSkipsHandshake(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+
+	results, err := run(context.Background(), testClient(ts, true), ts.URL, 2)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if !results[1].Reused{
+		t.Fatal("Expected the second run to reuse the connection")
+	}
+	if results[1].Phases["TLS Handshake"] != 0{
+		t.Errorf("Expected no TLS handshake on a reused connection, Got: %s", results[1].Phases["TLS Handshake"])
+	}
+}
+
+func TestSummarize(t *testing.T){
+	s := summarize([]time.Duration{4, 1, 3, 2})
+	if s.Min != 1 || s.Median != 2 || s.Max != 4{
+		t.Fatalf("Expected min 1, median 2, max 4, Got: %+v", s)
+	}
+	s = summarize([]time.Duration{5, 1, 3})
+	if s.Median != 3{
+		t.Fatalf("Expected median 3, Got: %v", s.Median)
+	}
+}
+
+func TestOutput(t *testing.T){
+	ts := startTestTLSServer()
+	defer ts.Close()
+
+	results, err := run(context.Background(), testClient(ts, false), ts.URL, 3)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	var text bytes.Buffer
+	writeText(&text, results)
+	for _, s := range []string{"Connected to " + ts.Listener.Addr().String(), "Server Processing", "median", "Total over 3 runs"}{
+		if !strings.Contains(text.String(), s){
+			t.Errorf("Expected text output to contain %q, Got:\n%s", s, text.String())
+		}
+	}
+
+	var b bytes.Buffer
+	if err := writeJSON(&b, results); err != nil{
+		t.Fatal(err)
+	}
+	out := jsonOutput{}
+	if err := json.Unmarshal(b.Bytes(), &out); err != nil{
+		t.Fatal(err)
+	}
+	if len(out.Runs) != 3{
+		t.Fatalf("Expected 3 runs in the JSON output, Got: %d", len(out.Runs))
+	}
+	if out.Summary["Server Processing"].MinMs < 10{
+		t.Errorf("Expected server processing to be at least 10ms, Got: %v", out.Summary["Server Processing"])
+	}
+}
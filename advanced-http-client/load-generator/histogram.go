@@ -0,0 +1,126 @@
+/*
+	Keeping every latency in a slice and sorting it works for a few thousand
+	requests, not for a few million. Instead we count the latencies in a
+	log-linear histogram (the idea behind HdrHistogram):
+
+		- the values (microseconds) are split in power of two ranges: [1,2), [2,4), [4,8)...
+		- every range is split again in subBuckets linear buckets
+
+	So the memory use is fixed and every bucket is at most 1/subBuckets
+	(~1.6%) wide relative to its values, which is precise enough for p99.9.
+
+*/
+
+package main
+
+import (
+	"math/bits"
+	"time"
+)
+
+const (
+	subBucketBits	= 6
+	subBuckets		= 1 << subBucketBits
+	// values up to 2^46 microseconds (~2 years), anything larger ends up in the last bucket
+	maxExponent		= 40
+	numBuckets		= (maxExponent + 1) * subBuckets
+)
+
+type histogram struct{
+	counts	[]uint64
+	total	uint64
+	sum		time.Duration
+	min		time.Duration
+	max		time.Duration
+}
+
+func newHistogram() *histogram{
+	return &histogram{counts: make([]uint64, numBuckets)}
+}
+
+// bucketIndex maps a value in microseconds to its bucket.
+func bucketIndex(v uint64) int{
+	if v < subBuckets{
+		// the first range is linear with a width of 1
+		return int(v)
+	}
+	exp := bits.Len64(v) - 1 - subBucketBits
+	if exp >= maxExponent{
+		return numBuckets - 1
+	}
+	sub := v >> uint(exp)
+	return (exp+1)*subBuckets + int(sub-subBuckets)
+}
+
+// bucketUpperBound is the highest value (microseconds) counted in bucket i.
+func bucketUpperBound(i int) uint64{
+	if i < subBuckets{
+		return uint64(i)
+	}
+	exp := i/subBuckets - 1
+	sub := uint64(i%subBuckets + subBuckets)
+	return (sub+1)<<uint(exp) - 1
+}
+
+func (h *histogram) record(d time.Duration){
+	if d < 0{
+		d = 0
+	}
+	h.counts[bucketIndex(uint64(d.Microseconds()))]++
+	if h.total == 0 || d < h.min{
+		h.min = d
+	}
+	if d > h.max{
+		h.max = d
+	}
+	h.total++
+	h.sum += d
+}
+
+func (h *histogram) merge(o *histogram){
+	for i, c := range o.counts{
+		h.counts[i] += c
+	}
+	if o.total > 0 && (h.total == 0 || o.min < h.min){
+		h.min = o.min
+	}
+	if o.max > h.max{
+		h.max = o.max
+	}
+	h.total += o.total
+	h.sum += o.sum
+}
+
+func (h *histogram) mean() time.Duration{
+	if h.total == 0{
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// percentile returns the latency below which p percent (0-100) of the requests fall.
+func (h *histogram) percentile(p float64) time.Duration{
+	if h.total == 0{
+		return 0
+	}
+	rank := uint64(p / 100 * float64(h.total) + 0.5)
+	if rank < 1{
+		rank = 1
+	}
+	var seen uint64
+	for i, c := range h.counts{
+		seen += c
+		if seen >= rank{
+			d := time.Duration(bucketUpperBound(i)) * time.Microsecond
+			// the bucket bounds are approximate, the extremes are not
+			if d > h.max{
+				d = h.max
+			}
+			if d < h.min{
+				d = h.min
+			}
+			return d
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,304 @@
+/*
+	The load generator runs `concurrency` workers sharing one http.Client,
+	so they share one connection pool - exactly what we want to observe when
+	tuning MaxIdleConnsPerHost and friends.
+
+	A scheduler goroutine hands out one ticket per request:
+		- as fast as the workers can take them when no rate is given,
+		- every 1/rps seconds otherwise (the rate is for all the workers together),
+	and stops after `requests` tickets or when `duration` is over, whichever comes first.
+
+	Every worker keeps its own counters and histogram, they are merged at the
+	end, so the hot path needs no locking.
+
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+type config struct{
+	URL			string
+	Method		string
+	Headers		http.Header
+	Body		[]byte
+	Concurrency	int
+	// Requests is the total number of requests, 0 means until Duration is over.
+	Requests	int
+	Duration	time.Duration
+	// RPS is the target rate over all the workers, 0 means no limit.
+	RPS			float64
+}
+
+// maxRPS bounds the rate: one ticker cannot tick faster than every microsecond or so anyway,
+// and above 1e9 the interval would round down to 0.
+const maxRPS = 1e6
+
+// stats is what one worker (and then the whole run) collected.
+type stats struct{
+	requests	int
+	statuses	map[int]int
+	errors		map[string]int
+	// GotConn may run on a transport goroutine, so these two are atomic
+	newConns	atomic.Int64
+	reusedConns	atomic.Int64
+	bytes		int64
+	latency		*histogram
+}
+
+func newStats() *stats{
+	return &stats{statuses: map[int]int{}, errors: map[string]int{}, latency: newHistogram()}
+}
+
+func (s *stats) merge(o *stats){
+	s.requests += o.requests
+	for k, v := range o.statuses{
+		s.statuses[k] += v
+	}
+	for k, v := range o.errors{
+		s.errors[k] += v
+	}
+	s.newConns.Add(o.newConns.Load())
+	s.reusedConns.Add(o.reusedConns.Load())
+	s.bytes += o.bytes
+	s.latency.merge(o.latency)
+}
+
+// report is the result of a run.
+type report struct{
+	*stats
+	elapsed	time.Duration
+}
+
+func (r report) throughput() float64{
+	if r.elapsed <= 0{
+		return 0
+	}
+	return float64(r.requests) / r.elapsed.Seconds()
+}
+
+func (r report) reuseRatio() float64{
+	reused := r.reusedConns.Load()
+	total := r.newConns.Load() + reused
+	if total == 0{
+		return 0
+	}
+	return float64(reused) / float64(total)
+}
+
+// categorizeError groups errors so that the report stays readable under heavy failure.
+func categorizeError(err error) string{
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var recordErr tls.RecordHeaderError
+	switch{
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused"
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection reset"
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &recordErr):
+		return "tls"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	return "other"
+}
+
+func newRequest(ctx context.Context, cfg config, s *stats) (*http.Request, error){
+	var body io.Reader
+	if len(cfg.Body) > 0{
+		body = bytes.NewReader(cfg.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, cfg.Method, cfg.URL, body)
+	if err != nil{
+		return nil, err
+	}
+	for k, v := range cfg.Headers{
+		req.Header[k] = v
+	}
+	if host := cfg.Headers.Get("Host"); host != ""{
+		req.Host = host
+	}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused{
+				s.reusedConns.Add(1)
+			}else{
+				s.newConns.Add(1)
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), nil
+}
+
+func doRequest(ctx context.Context, client *http.Client, cfg config, s *stats){
+	req, err := newRequest(ctx, cfg, s)
+	if err != nil{
+		s.errors["invalid request"]++
+		return
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil{
+		// requests cut short because the run is over are not counted
+		if ctx.Err() != nil{
+			return
+		}
+		s.requests++
+		s.latency.record(time.Since(start))
+		s.errors[categorizeError(err)]++
+		return
+	}
+	// the body must be read to EOF for the connection to go back to the pool
+	n, err := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil && ctx.Err() != nil{
+		return
+	}
+	s.requests++
+	s.latency.record(time.Since(start))
+	s.bytes += n
+	if err != nil{
+		s.errors[categorizeError(err)]++
+		return
+	}
+	s.statuses[resp.StatusCode]++
+}
+
+// schedule sends the tickets, it closes the channel when the run is over.
+func schedule(ctx context.Context, cfg config, tickets chan<- struct{}){
+	defer close(tickets)
+	var tick <-chan time.Time
+	if cfg.RPS > 0{
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.RPS))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for sent := 0; cfg.Requests == 0 || sent < cfg.Requests; sent++{
+		if tick != nil{
+			select{
+			case <-ctx.Done():
+				return
+			case <-tick:
+			}
+		}
+		select{
+		case <-ctx.Done():
+			return
+		case tickets <- struct{}{}:
+		}
+	}
+}
+
+func runLoad(ctx context.Context, client *http.Client, cfg config) (report, error){
+	if cfg.Concurrency < 1{
+		return report{}, errors.New("concurrency must be at least 1")
+	}
+	if cfg.Requests <= 0 && cfg.Duration <= 0{
+		return report{}, errors.New("either the number of requests or the duration must be set")
+	}
+	//written this way round so NaN is rejected too
+	if !(cfg.RPS >= 0 && cfg.RPS <= maxRPS){
+		return report{}, fmt.Errorf("the rate must be between 0 and %g requests per second, got %g", float64(maxRPS), cfg.RPS)
+	}
+	if cfg.Method == ""{
+		cfg.Method = http.MethodGet
+	}
+
+	if cfg.Duration > 0{
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	tickets := make(chan struct{})
+	workerStats := make([]*stats, cfg.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	go schedule(ctx, cfg, tickets)
+	for i := range workerStats{
+		s := newStats()
+		workerStats[i] = s
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			for range tickets{
+				doRequest(ctx, client, cfg, s)
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := newStats()
+	for _, s := range workerStats{
+		total.merge(s)
+	}
+	return report{stats: total, elapsed: time.Since(start)}, nil
+}
+
+func writeReport(w io.Writer, r report){
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Summary:\n")
+	fmt.Fprintf(tw, "  Requests:\t%d\n", r.requests)
+	fmt.Fprintf(tw, "  Elapsed:\t%s\n", r.elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "  Throughput:\t%.2f req/s\n", r.throughput())
+	fmt.Fprintf(tw, "  Bytes read:\t%d\n", r.bytes)
+	fmt.Fprintf(tw, "  Connections:\t%d new, %d reused (%.1f%% reused)\n", r.newConns.Load(), r.reusedConns.Load(), r.reuseRatio()*100)
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nLatency:\n")
+	fmt.Fprintf(tw, "  min\t%s\n", r.latency.min)
+	fmt.Fprintf(tw, "  mean\t%s\n", r.latency.mean())
+	for _, p := range []float64{50, 90, 99, 99.9}{
+		fmt.Fprintf(tw, "  p%g\t%s\n", p, r.latency.percentile(p))
+	}
+	fmt.Fprintf(tw, "  max\t%s\n", r.latency.max)
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nStatus codes:\n")
+	codes := make([]int, 0, len(r.statuses))
+	for c := range r.statuses{
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	for _, c := range codes{
+		fmt.Fprintf(w, "  [%d] %d responses\n", c, r.statuses[c])
+	}
+
+	if len(r.errors) > 0{
+		fmt.Fprintf(w, "\nErrors:\n")
+		categories := make([]string, 0, len(r.errors))
+		for c := range r.errors{
+			categories = append(categories, c)
+		}
+		sort.Strings(categories)
+		for _, c := range categories{
+			fmt.Fprintf(w, "  [%s] %d\n", c, r.errors[c])
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHistogramPercentiles(t *testing.T){
+	h := newHistogram()
+	for i := 1; i <= 1000; i++{
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	for p, expected := range map[float64]time.Duration{
+		50:		500 *time.Millisecond,
+		90:		900 *time.Millisecond,
+		99:		990 *time.Millisecond,
+		99.9:	999 *time.Millisecond,
+		100:	1000 *time.Millisecond,
+	}{
+		got := h.percentile(p)
+		// the buckets are at most 1/64 wide
+		if diff := got - expected; diff < 0 || diff > expected/64{
+			t.Errorf("Expected p%g to be about %s, Got: %s", p, expected, got)
+		}
+	}
+	if h.min != time.Millisecond || h.max != time.Second{
+		t.Errorf("Expected min 1ms and max 1s, Got: %s and %s", h.min, h.max)
+	}
+}
+
+func TestBucketIndexRoundTrip(t *testing.T){
+	for _, v := range []uint64{0, 1, 63, 64, 65, 127, 128, 1000, 123456789}{
+		i := bucketIndex(v)
+		if upper := bucketUpperBound(i); upper < v{
+			t.Errorf("Expected bucket %d of %d to have an upper bound >= %d, Got: %d", i, v, v, upper)
+		}
+		if i > 0 && bucketUpperBound(i-1) >= v{
+			t.Errorf("Expected %d not to fit in the previous bucket %d", v, i-1)
+		}
+	}
+}
+
+func TestRunLoad(t *testing.T){
+	var hits atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		if r.Method != "POST" || r.Header.Get("X-Client-Id") != "load-test"{
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"name":"mypackage"}`{
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if n%10 == 0{
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "Hello World")
+	}))
+	defer ts.Close()
+
+	cfg := config{
+		URL:			ts.URL,
+		Method:			"POST",
+		Headers:		http.Header{"X-Client-Id": {"load-test"}},
+		Body:			[]byte(`{"name":"mypackage"}`),
+		Concurrency:	4,
+		Requests:		100,
+	}
+	client := createClient(5 *time.Second, 100, 4, 0, time.Minute, false)
+	r, err := runLoad(context.Background(), client, cfg)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	if r.requests != 100{
+		t.Fatalf("Expected 100 requests, Got: %d", r.requests)
+	}
+	if r.statuses[200] != 90 || r.statuses[500] != 10{
+		t.Errorf("Expected 90 x 200 and 10 x 500, Got: %v", r.statuses)
+	}
+	if conns := r.newConns.Load(); conns > 4{
+		t.Errorf("Expected at most 4 new connections for 4 workers, Got: %d", conns)
+	}
+	if r.reuseRatio() < 0.9{
+		t.Errorf("Expected most connections to be reused, Got ratio: %.2f", r.reuseRatio())
+	}
+
+	var b bytes.Buffer
+	writeReport(&b, r)
+	for _, s := range []string{"Requests:", "p99.9", "[200] 90 responses", "[500] 10 responses"}{
+		if !strings.Contains(b.String(), s){
+			t.Errorf("Expected report to contain %q, Got:\n%s", s, b.String())
+		}
+	}
+}
+
+func TestRunLoadDurationAndRate(t *testing.T){
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello World")
+	}))
+	defer ts.Close()
+
+	cfg := config{URL: ts.URL, Concurrency: 2, Duration: 500 *time.Millisecond, RPS: 20}
+	r, err := runLoad(context.Background(), createClient(5 *time.Second, 100, 2, 0, time.Minute, false), cfg)
+	if err != nil{
+		t.Fatal(err)
+	}
+	// 20 req/s for half a second, allow for ticker jitter
+	if r.requests < 5 || r.requests > 11{
+		t.Errorf("Expected about 10 requests, Got: %d", r.requests)
+	}
+}
+
+func TestRunLoadErrors(t *testing.T){
+	// a port nobody listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cfg := config{URL: "http://" + addr, Concurrency: 2, Requests: 4}
+	r, err := runLoad(context.Background(), createClient(time.Second, 100, 2, 0, time.Minute, false), cfg)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if r.errors["connection refused"] != 4{
+		t.Errorf("Expected 4 connection refused errors, Got: %v", r.errors)
+	}
+}
+
+func TestRunLoadInvalidRate(t *testing.T){
+	client := createClient(time.Second, 100, 2, 0, time.Minute, false)
+	for _, rps := range []float64{-1, math.NaN(), math.Inf(1), 2e9}{
+		cfg := config{URL: "http://127.0.0.1:0", Concurrency: 1, Requests: 1, RPS: rps}
+		if _, err := runLoad(context.Background(), client, cfg); err == nil{
+			t.Errorf("Expected an error for a rate of %g, Got nil", rps)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+	connection-pooling sends the same request forever with a one second
+	sleep, which tells us how the pool behaves for one idle client. To
+	validate pool settings before a deployment we need real load:
+
+		$ go run . -c 50 -z 30s -q 500 -max-idle-per-host 50 https://example.com/api/packages
+
+	runs 50 workers for 30 seconds at 500 requests per second in total, and
+	prints throughput, status codes, error categories, the share of reused
+	connections and the latency percentiles.
+
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// headerFlags collects the repeated -H "Name: value" flags.
+type headerFlags http.Header
+
+func (h headerFlags) String() string{
+	var parts []string
+	for k, v := range h{
+		parts = append(parts, k+": "+strings.Join(v, ","))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (h headerFlags) Set(v string) error{
+	name, value, ok := strings.Cut(v, ":")
+	if !ok{
+		return fmt.Errorf("header must be of the form Name: value, got %q", v)
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	return nil
+}
+
+// createClient builds the client shared by all the workers, the pool settings come from the flags.
+func createClient(d time.Duration, maxIdle, maxIdlePerHost, maxConnsPerHost int, idleTimeout time.Duration, disableKeepAlives bool) *http.Client{
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdle
+	transport.MaxIdleConnsPerHost = maxIdlePerHost
+	transport.MaxConnsPerHost = maxConnsPerHost
+	transport.IdleConnTimeout = idleTimeout
+	transport.DisableKeepAlives = disableKeepAlives
+	client := http.Client{Timeout: d, Transport: transport}
+	return &client
+}
+
+func main(){
+	cfg := config{Headers: http.Header{}}
+	flag.IntVar(&cfg.Concurrency, "c", 10, "number of concurrent workers")
+	flag.IntVar(&cfg.Requests, "n", 0, "total number of requests, 0 means until -z is over")
+	flag.DurationVar(&cfg.Duration, "z", 0, "duration of the run, e.g. 30s")
+	flag.Float64Var(&cfg.RPS, "q", 0, "target requests per second over all the workers, 0 means no limit")
+	flag.StringVar(&cfg.Method, "m", "GET", "HTTP method")
+	flag.Var(headerFlags(cfg.Headers), "H", "request header, can be repeated: -H 'Accept: application/json'")
+	body := flag.String("d", "", "request body, @file reads it from a file")
+	timeout := flag.Duration("timeout", 10 *time.Second, "time-out of each request")
+	maxIdle := flag.Int("max-idle", 100, "Transport.MaxIdleConns")
+	maxIdlePerHost := flag.Int("max-idle-per-host", http.DefaultMaxIdleConnsPerHost, "Transport.MaxIdleConnsPerHost")
+	maxConnsPerHost := flag.Int("max-conns-per-host", 0, "Transport.MaxConnsPerHost, 0 means no limit")
+	idleTimeout := flag.Duration("idle-timeout", 90 *time.Second, "Transport.IdleConnTimeout")
+	disableKeepAlives := flag.Bool("disable-keepalives", false, "Transport.DisableKeepAlives")
+	flag.Parse()
+
+	if flag.NArg() != 1{
+		fmt.Fprintln(os.Stderr, "Usage: load-generator [flags] URL")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	cfg.URL = flag.Arg(0)
+	if cfg.Requests == 0 && cfg.Duration == 0{
+		cfg.Requests = 200
+	}
+
+	if strings.HasPrefix(*body, "@"){
+		data, err := os.ReadFile(strings.TrimPrefix(*body, "@"))
+		if err != nil{
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		cfg.Body = data
+	}else{
+		cfg.Body = []byte(*body)
+	}
+
+	// ctrl + c stops the run early, the report is still printed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := createClient(*timeout, *maxIdle, *maxIdlePerHost, *maxConnsPerHost, *idleTimeout, *disableKeepAlives)
+	r, err := runLoad(ctx, client, cfg)
+	if err != nil{
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	writeReport(os.Stdout, r)
+}
@@ -0,0 +1,210 @@
+/*
+	The connection-pooling notes answer "what if the IP behind a pooled
+	connection goes away?": a new connection is opened. The opposite problem
+	is a connection that never goes away. Behind a DNS based load balancer a
+	keep-alive connection that is used every second is never idle long
+	enough to hit IdleConnTimeout, so the client stays pinned to the same
+	backend forever, and DNS changes are never picked up.
+
+	MaxAgeTransport retires connections once they are older than MaxAge:
+
+		- the dialers (DialContext, Dial and DialTLSContext) give every new
+		  connection a deadline,
+		- a request that gets a connection past its deadline is sent with
+		  "Connection: close", the Transport (or the server, when the Transport
+		  works on a copy of the request) closes the connection once the
+		  response has been read,
+		- the next request then dials again, which means a fresh DNS lookup.
+
+	The connection is never closed underneath the Transport: an idle
+	connection could be handed to a request at the same moment, and a POST
+	without GetBody cannot be retried on another one. So an expired idle
+	connection serves one last request, or is closed by IdleConnTimeout.
+
+	A *tls.Conn returned by DialTLSContext cannot be wrapped (the Transport
+	reads the TLS state, and negotiates HTTP/2, only from a *tls.Conn), its
+	deadline is kept in a map instead. An HTTP/2 connection cannot be told
+	to stop taking requests: once one was found expired, the next request
+	closes the idle connections of the Transport first (CloseIdleConnections
+	only closes an HTTP/2 connection without streams, and also closes the
+	idle connections to the other hosts). Under a load that never leaves it
+	idle, an HTTP/2 connection is not retired.
+
+	The lifetime is picked at random in [MaxAge-Jitter, MaxAge], so that
+	connections opened at the same time (e.g. at startup) do not all
+	reconnect at the same time.
+
+	A request in flight is never interrupted, whatever the age of its connection.
+
+*/
+
+package maxconnage
+
+import (
+	"context"
+	"crypto/tls"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+type MaxAgeTransport struct{
+	transport	*http.Transport
+	MaxAge		time.Duration
+	Jitter		time.Duration
+
+	mu			sync.Mutex
+	// deadlines of the *tls.Conn returned by DialTLSContext, only the ones not expired yet
+	tlsConns	map[net.Conn]time.Time
+	dialsTLS	bool
+	// an expired HTTP/2 connection is waiting to be closed once idle
+	retireH2	bool
+}
+
+// NewMaxAgeTransport clones base (http.DefaultTransport if nil) and wraps its dialers,
+// so the connections it opens are retired after maxAge.
+func NewMaxAgeTransport(base *http.Transport, maxAge, jitter time.Duration) *MaxAgeTransport{
+	if base == nil{
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	t := &MaxAgeTransport{transport: base.Clone(), MaxAge: maxAge, Jitter: jitter, tlsConns: map[net.Conn]time.Time{}}
+
+	dial := base.DialContext
+	if dial == nil && base.Dial != nil{
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error){
+			return base.Dial(network, addr)
+		}
+	}
+	if dial == nil{
+		dial = (&net.Dialer{Timeout: 30 *time.Second, KeepAlive: 30 *time.Second}).DialContext
+	}
+	t.transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error){
+		conn, err := dial(ctx, network, addr)
+		if err != nil{
+			return nil, err
+		}
+		return &agedConn{Conn: conn, deadline: time.Now().Add(t.lifetime())}, nil
+	}
+	t.transport.Dial = nil
+
+	dialTLS := base.DialTLSContext
+	if dialTLS == nil && base.DialTLS != nil{
+		dialTLS = func(ctx context.Context, network, addr string) (net.Conn, error){
+			return base.DialTLS(network, addr)
+		}
+	}
+	if dialTLS != nil{
+		t.dialsTLS = true
+		t.transport.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error){
+			conn, err := dialTLS(ctx, network, addr)
+			if err != nil{
+				return nil, err
+			}
+			deadline := time.Now().Add(t.lifetime())
+			if _, ok := conn.(*tls.Conn); !ok{
+				return &agedConn{Conn: conn, deadline: deadline}, nil
+			}
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsConns[conn] = deadline
+			return conn, nil
+		}
+		t.transport.DialTLS = nil
+	}
+	return t
+}
+
+// lifetime picks the lifetime of a new connection.
+func (t *MaxAgeTransport) lifetime() time.Duration{
+	jitter := t.Jitter
+	if jitter > t.MaxAge{
+		jitter = t.MaxAge
+	}
+	if jitter <= 0{
+		return t.MaxAge
+	}
+	return t.MaxAge - time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// expired tells whether the connection the Transport reports is past its deadline.
+func (t *MaxAgeTransport) expired(c net.Conn) bool{
+	now := time.Now()
+	//our connection is under the *tls.Conn the Transport adds for https, maybe under a proxy's too
+	for inner := c; ; {
+		if ac, ok := inner.(*agedConn); ok{
+			return now.After(ac.deadline)
+		}
+		tc, ok := inner.(*tls.Conn)
+		if !ok{
+			break
+		}
+		inner = tc.NetConn()
+	}
+	if _, ok := c.(*tls.Conn); !ok || !t.dialsTLS{
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for conn, deadline := range t.tlsConns{
+		if now.After(deadline){
+			delete(t.tlsConns, conn)
+		}
+	}
+	//a connection of DialTLSContext that is not in the map any more has expired
+	_, ok := t.tlsConns[c]
+	return !ok
+}
+
+func (t *MaxAgeTransport) CloseIdleConnections(){
+	t.transport.CloseIdleConnections()
+}
+
+func (t *MaxAgeTransport) RoundTrip(r *http.Request)(*http.Response, error){
+	t.mu.Lock()
+	retire := t.retireH2
+	t.retireH2 = false
+	t.mu.Unlock()
+	if retire{
+		t.transport.CloseIdleConnections()
+	}
+
+	var req *http.Request
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !t.expired(info.Conn){
+				return
+			}
+			if tc, ok := info.Conn.(*tls.Conn); ok && tc.ConnectionState().NegotiatedProtocol == "h2"{
+				t.mu.Lock()
+				t.retireH2 = true
+				t.mu.Unlock()
+				return
+			}
+			// the Transport works on a copy of a request with a body, the header map is shared:
+			// the server answers "Connection: close" and the Transport drops the connection
+			req.Close = true
+			req.Header.Set("Connection", "close")
+		},
+	}
+	req = r.Clone(httptrace.WithClientTrace(r.Context(), trace))
+	return t.transport.RoundTrip(req)
+}
+
+// agedConn is a connection with the time it must be retired at.
+type agedConn struct{
+	net.Conn
+	deadline	time.Time
+}
+
+// createClientWithMaxConnAge returns a client whose connections live at most maxAge.
+func createClientWithMaxConnAge(d, maxAge, jitter time.Duration) *http.Client{
+	client := http.Client{
+		Timeout:	d,
+		Transport:	NewMaxAgeTransport(nil, maxAge, jitter),
+	}
+	return &client
+}
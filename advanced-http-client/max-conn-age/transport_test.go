@@ -0,0 +1,210 @@
+package maxconnage
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTransport returns a transport whose dialer counts the connections it opens.
+func countingTransport() (*http.Transport, *atomic.Int64){
+	var dials atomic.Int64
+	d := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials.Add(1)
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	return transport, &dials
+}
+
+func startTestHTTPServer(delay time.Duration) *httptest.Server{
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		fmt.Fprint(w, "Hello World")
+	}))
+	return ts
+}
+
+func get(client *http.Client, url string) error{
+	resp, err := client.Get(url)
+	if err != nil{
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err == nil && string(body) != "Hello World"{
+		err = fmt.Errorf("unexpected body: %s", body)
+	}
+	return err
+}
+
+func TestMaxAgeRetiresBusyConnections(t *testing.T){
+	ts := startTestHTTPServer(0)
+	defer ts.Close()
+
+	base, dials := countingTransport()
+	client := &http.Client{Transport: NewMaxAgeTransport(base, 100 *time.Millisecond, 0)}
+
+	// a request every 20ms keeps the connection from ever being idle long
+	deadline := time.Now().Add(450 *time.Millisecond)
+	for time.Now().Before(deadline){
+		if err := get(client, ts.URL); err != nil{
+			t.Fatal(err)
+		}
+		time.Sleep(20 *time.Millisecond)
+	}
+	if n := dials.Load(); n < 4 || n > 6{
+		t.Fatalf("Expected about 5 connections over 450ms with a max age of 100ms, Got: %d", n)
+	}
+}
+
+func TestWithoutMaxAgeConnectionIsKept(t *testing.T){
+	ts := startTestHTTPServer(0)
+	defer ts.Close()
+
+	base, dials := countingTransport()
+	client := &http.Client{Transport: base}
+	for i := 0; i < 10; i++{
+		if err := get(client, ts.URL); err != nil{
+			t.Fatal(err)
+		}
+		time.Sleep(20 *time.Millisecond)
+	}
+	if n := dials.Load(); n != 1{
+		t.Fatalf("Expected a single connection, Got: %d", n)
+	}
+}
+
+func TestMaxAgeDoesNotInterruptRequests(t *testing.T){
+	// the response takes longer than the connection is allowed to live
+	ts := startTestHTTPServer(150 *time.Millisecond)
+	defer ts.Close()
+
+	base, dials := countingTransport()
+	client := &http.Client{Transport: NewMaxAgeTransport(base, 50 *time.Millisecond, 0)}
+
+	// the expired connection sits idle in the pool, it serves one last request and is then replaced
+	for i := 0; i < 3; i++{
+		if err := get(client, ts.URL); err != nil{
+			t.Fatal(err)
+		}
+	}
+	if n := dials.Load(); n != 2{
+		t.Fatalf("Expected the expired connection to be replaced, Got: %d connections", n)
+	}
+}
+
+func TestMaxAgeExpiredIdleConnectionTakesPost(t *testing.T){
+	var closes atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if r.Close{
+			closes.Add(1)
+		}
+		fmt.Fprint(w, "Hello World")
+	}))
+	defer ts.Close()
+
+	base, dials := countingTransport()
+	client := &http.Client{Transport: NewMaxAgeTransport(base, 20 *time.Millisecond, 0)}
+	if err := get(client, ts.URL); err != nil{
+		t.Fatal(err)
+	}
+	// the connection expires while idle, it must not be closed underneath the Transport
+	time.Sleep(50 *time.Millisecond)
+	for i := 0; i < 2; i++{
+		// a body without GetBody, the request cannot be retried on another connection
+		resp, err := client.Post(ts.URL, "text/plain", io.MultiReader(strings.NewReader("Hello World")))
+		if err != nil{
+			t.Fatal(err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if n := dials.Load(); n != 2 || closes.Load() != 1{
+		t.Fatalf("Expected the first POST to retire the expired connection, Got: %d connections, %d Connection: close", n, closes.Load())
+	}
+}
+
+func TestMaxAgeWrapsEveryDialer(t *testing.T){
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello World")
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	tlsConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig
+
+	var dials atomic.Int64
+	bases := map[string]*http.Transport{
+		"Dial": {
+			TLSClientConfig:	tlsConfig,
+			Dial: func(network, addr string) (net.Conn, error) {
+				dials.Add(1)
+				return net.Dial(network, addr)
+			},
+		},
+		"DialTLSContext": {
+			DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dials.Add(1)
+				return (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, network, addr)
+			},
+		},
+		"DialTLSContext h2": {
+			ForceAttemptHTTP2:	true,
+			DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dials.Add(1)
+				c := tlsConfig.Clone()
+				c.NextProtos = []string{"h2"}
+				return (&tls.Dialer{Config: c}).DialContext(ctx, network, addr)
+			},
+		},
+	}
+	for name, base := range bases{
+		dials.Store(0)
+		client := &http.Client{Transport: NewMaxAgeTransport(base, 50 *time.Millisecond, 0)}
+		for i := 0; i < 3; i++{
+			resp, err := client.Get(ts.URL)
+			if err != nil{
+				t.Fatalf("%s: %v", name, err)
+			}
+			io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.TLS == nil{
+				t.Errorf("%s: Expected the TLS state of the response", name)
+			}
+			if name == "DialTLSContext h2" && resp.ProtoMajor != 2{
+				t.Errorf("%s: Expected HTTP/2, Got: %s", name, resp.Proto)
+			}
+			time.Sleep(60 *time.Millisecond)
+		}
+		// the second request is the last on the expired connection, the third dials again
+		if n := dials.Load(); n != 2{
+			t.Errorf("%s: Expected 2 connections, Got: %d", name, n)
+		}
+	}
+}
+
+func TestLifetimeJitter(t *testing.T){
+	tr := NewMaxAgeTransport(nil, time.Minute, 10 *time.Second)
+	for i := 0; i < 100; i++{
+		if l := tr.lifetime(); l > time.Minute || l <= 50 *time.Second{
+			t.Fatalf("Expected lifetime in (50s, 1m], Got: %s", l)
+		}
+	}
+
+	client := createClientWithMaxConnAge(5 *time.Second, time.Minute, 0)
+	if l := client.Transport.(*MaxAgeTransport).lifetime(); l != time.Minute{
+		t.Fatalf("Expected lifetime of 1m without jitter, Got: %s", l)
+	}
+}
@@ -0,0 +1,290 @@
+/*
+	A tiny metrics registry that speaks the Prometheus text exposition format
+	(https://prometheus.io/docs/instrumenting/exposition_formats/):
+
+		# HELP http_client_requests_total Requests sent, by host, method and status class.
+		# TYPE http_client_requests_total counter
+		http_client_requests_total{host="example.com",method="GET",code="2xx"} 3
+
+	Only counters and histograms are needed by the transport, so that is all
+	we implement here. This keeps the module free of external dependencies
+	while the output can still be scraped by a real Prometheus server.
+
+	A name is registered once per registry: asking again for a metric of
+	the same kind and labels returns the existing one, so several
+	transports (one per client) can share a registry and add up in the
+	same series. A name reused with another kind or other labels panics,
+	the exposition would otherwise have two conflicting families.
+
+*/
+
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds all the metrics and renders them in registration order.
+type Registry struct{
+	mu			sync.Mutex
+	collectors	[]collector
+	byName		map[string]collector
+}
+
+type collector interface{
+	write(w io.Writer)
+}
+
+func NewRegistry() *Registry{
+	return &Registry{}
+}
+
+// register adds the collector made by create under name, or returns the one already registered.
+func (r *Registry) register(name string, create func() collector) collector{
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.byName[name]; ok{
+		return c
+	}
+	if r.byName == nil{
+		r.byName = map[string]collector{}
+	}
+	c := create()
+	r.byName[name] = c
+	r.collectors = append(r.collectors, c)
+	return c
+}
+
+// WritePrometheus writes every metric in the text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error{
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors{
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics, mount it on /metrics.
+func (r *Registry) Handler() http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+// metricDesc is shared by counters and histograms: a name, a help text and the label names.
+type metricDesc struct{
+	name		string
+	help		string
+	labelNames	[]string
+}
+
+func (d metricDesc) header(w io.Writer, kind string){
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, kind)
+}
+
+// labelKey joins the label values, it is used as the map key of a series.
+func (d metricDesc) labelKey(values []string) string{
+	if len(values) != len(d.labelNames){
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", d.name, len(d.labelNames), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (d metricDesc) labels(key string, extra ...string) string{
+	var parts []string
+	if len(d.labelNames) > 0{
+		for i, v := range strings.Split(key, "\xff"){
+			parts = append(parts, fmt.Sprintf(`%s="%s"`, d.labelNames[i], escapeLabel(v)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2{
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+	if len(parts) == 0{
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct{
+	metricDesc
+	mu		sync.Mutex
+	values	map[string]float64
+}
+
+// NewCounterVec registers a counter, or returns the counter already registered as name.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec{
+	c, ok := r.register(name, func() collector{
+		return &CounterVec{metricDesc: metricDesc{name, help, labelNames}, values: map[string]float64{}}
+	}).(*CounterVec)
+	if !ok || !sameLabels(c.labelNames, labelNames){
+		panic(fmt.Sprintf("metric %s: already registered with another type or other labels", name))
+	}
+	return c
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string){
+	key := c.labelKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += v
+}
+
+func (c *CounterVec) Inc(labelValues ...string){
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current value of one series, 0 if it was never incremented.
+func (c *CounterVec) Value(labelValues ...string) float64{
+	key := c.labelKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *CounterVec) write(w io.Writer){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, "counter")
+	for _, key := range sortedKeys(c.values){
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(key), formatFloat(c.values[key]))
+	}
+}
+
+// HistogramVec is a histogram partitioned by labels. Buckets are upper bounds, +Inf is implicit.
+type HistogramVec struct{
+	metricDesc
+	buckets	[]float64
+	mu		sync.Mutex
+	series	map[string]*histogramSeries
+}
+
+type histogramSeries struct{
+	counts	[]uint64	// not cumulative, one per bucket plus +Inf
+	sum		float64
+	count	uint64
+}
+
+// Bucket layouts used by the transport.
+var (
+	DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	DefaultSizeBuckets    = []float64{100, 1000, 10000, 100000, 1e6, 1e7, 1e8}
+)
+
+// NewHistogramVec registers a histogram, or returns the histogram already registered as name.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec{
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	h, ok := r.register(name, func() collector{
+		return &HistogramVec{metricDesc: metricDesc{name, help, labelNames}, buckets: b, series: map[string]*histogramSeries{}}
+	}).(*HistogramVec)
+	if !ok || !sameLabels(h.labelNames, labelNames){
+		panic(fmt.Sprintf("metric %s: already registered with another type or other labels", name))
+	}
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string){
+	key := h.labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok{
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	i := sort.SearchFloat64s(h.buckets, v)
+	s.counts[i]++
+	s.sum += v
+	s.count++
+}
+
+// Count returns the number of observations of one series.
+func (h *HistogramVec) Count(labelValues ...string) uint64{
+	key := h.labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key]; ok{
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer){
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series{
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, key := range keys{
+		s := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets{
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(key), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(key), s.count)
+	}
+}
+
+func sameLabels(a, b []string) bool{
+	if len(a) != len(b){
+		return false
+	}
+	for i := range a{
+		if a[i] != b[i]{
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]float64) []string{
+	keys := make([]string, 0, len(m))
+	for k := range m{
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string{
+	switch{
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string{
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string{
+	return helpEscaper.Replace(s)
+}
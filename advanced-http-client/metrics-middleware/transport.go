@@ -0,0 +1,115 @@
+/*
+	MetricsTransport is a RoundTripper middleware that records, for every
+	request:
+
+		http_client_requests_total{host, method, code}	code is the status class (2xx, 4xx..) or "error"
+		http_client_request_duration_seconds{host, method}	time until the response headers arrived
+		http_client_response_size_bytes{host, method}		bytes read from the response body
+		http_client_connections_total{host, reused}		httptrace GotConnInfo.Reused, the same
+														signal the connection-pooling example prints
+
+	The size is only known once the body has been read, so it is observed
+	when the caller reaches EOF or closes the body.
+
+*/
+
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type MetricsTransport struct{
+	// Transport is the RoundTripper that actually sends the request, http.DefaultTransport if nil.
+	Transport		http.RoundTripper
+
+	requests		*CounterVec
+	duration		*HistogramVec
+	responseSize	*HistogramVec
+	connections		*CounterVec
+}
+
+// NewMetricsTransport registers the client metrics on reg and returns a transport that updates them.
+// Transports created on the same registry share the metrics.
+func NewMetricsTransport(reg *Registry, transport http.RoundTripper) *MetricsTransport{
+	return &MetricsTransport{
+		Transport:		transport,
+		requests:		reg.NewCounterVec("http_client_requests_total", "Requests sent, by host, method and status class.", "host", "method", "code"),
+		duration:		reg.NewHistogramVec("http_client_request_duration_seconds", "Time until the response headers were received.", DefaultLatencyBuckets, "host", "method"),
+		responseSize:	reg.NewHistogramVec("http_client_response_size_bytes", "Size of the response bodies read.", DefaultSizeBuckets, "host", "method"),
+		connections:	reg.NewCounterVec("http_client_connections_total", "Connections obtained for requests, by whether they were reused from the pool.", "host", "reused"),
+	}
+}
+
+func (m *MetricsTransport) RoundTrip(r *http.Request)(*http.Response, error){
+	transport := m.Transport
+	if transport == nil{
+		transport = http.DefaultTransport
+	}
+	host := r.URL.Host
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			m.connections.Inc(host, strconv.FormatBool(info.Reused))
+		},
+	}
+	reqCopy := r.Clone(httptrace.WithClientTrace(r.Context(), trace))
+
+	start := time.Now()
+	resp, err := transport.RoundTrip(reqCopy)
+	m.duration.Observe(time.Since(start).Seconds(), host, r.Method)
+	if err != nil{
+		m.requests.Inc(host, r.Method, "error")
+		return resp, err
+	}
+	m.requests.Inc(host, r.Method, statusClass(resp.StatusCode))
+
+	resp.Body = &countingBody{ReadCloser: resp.Body, done: func(n int64) {
+		m.responseSize.Observe(float64(n), host, r.Method)
+	}}
+	return resp, nil
+}
+
+func statusClass(code int) string{
+	if code < 100 || code > 599{
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// countingBody counts the bytes read and reports them once.
+type countingBody struct{
+	io.ReadCloser
+	n		int64
+	once	sync.Once
+	done	func(int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error){
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err == io.EOF{
+		b.once.Do(func() { b.done(b.n) })
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error{
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.n) })
+	return err
+}
+
+// createClientWithMetrics returns a client whose traffic is recorded in reg.
+func createClientWithMetrics(d time.Duration, reg *Registry) *http.Client{
+	client := http.Client{
+		Timeout:	d,
+		Transport:	NewMetricsTransport(reg, nil),
+	}
+	return &client
+}
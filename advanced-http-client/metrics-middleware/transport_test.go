@@ -0,0 +1,130 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startTestHTTPServer() *httptest.Server{
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing"{
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "Hello World")
+	}))
+	return ts
+}
+
+func TestMetricsTransport(t *testing.T){
+	ts := startTestHTTPServer()
+	defer ts.Close()
+
+	reg := NewRegistry()
+	client := createClientWithMetrics(5 *time.Second, reg)
+
+	for _, path := range []string{"/", "/", "/missing"}{
+		resp, err := client.Get(ts.URL + path)
+		if err != nil{
+			t.Fatal(err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	u, _ := url.Parse(ts.URL)
+	host := u.Host
+
+	m := client.Transport.(*MetricsTransport)
+	if v := m.requests.Value(host, "GET", "2xx"); v != 2{
+		t.Errorf("Expected 2 requests with status 2xx, Got: %v", v)
+	}
+	if v := m.requests.Value(host, "GET", "4xx"); v != 1{
+		t.Errorf("Expected 1 request with status 4xx, Got: %v", v)
+	}
+	// the body is read to EOF and closed every time, so the connection is reused after the first request
+	if v := m.connections.Value(host, "false"); v != 1{
+		t.Errorf("Expected 1 new connection, Got: %v", v)
+	}
+	if v := m.connections.Value(host, "true"); v != 2{
+		t.Errorf("Expected 2 reused connections, Got: %v", v)
+	}
+	if c := m.responseSize.Count(host, "GET"); c != 3{
+		t.Errorf("Expected 3 response size observations, Got: %d", c)
+	}
+
+	ms := httptest.NewServer(reg.Handler())
+	defer ms.Close()
+	resp, err := http.Get(ms.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	for _, line := range []string{
+		"# TYPE http_client_requests_total counter",
+		fmt.Sprintf(`http_client_requests_total{host="%s",method="GET",code="2xx"} 2`, host),
+		"# TYPE http_client_request_duration_seconds histogram",
+		fmt.Sprintf(`http_client_request_duration_seconds_bucket{host="%s",method="GET",le="+Inf"} 3`, host),
+		fmt.Sprintf(`http_client_response_size_bytes_bucket{host="%s",method="GET",le="100"} 3`, host),
+		fmt.Sprintf(`http_client_response_size_bytes_sum{host="%s",method="GET"} 41`, host),
+		fmt.Sprintf(`http_client_connections_total{host="%s",reused="true"} 2`, host),
+	}{
+		if !strings.Contains(string(body), line+"\n"){
+			t.Errorf("Expected metrics output to contain: %s\nGot:\n%s", line, body)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T){
+	reg := NewRegistry()
+	c := reg.NewCounterVec("test_total", "A test counter.", "path")
+	c.Inc("a\"b\\c\nd")
+
+	var b strings.Builder
+	reg.WritePrometheus(&b)
+	expected := `test_total{path="a\"b\\c\nd"} 1`
+	if !strings.Contains(b.String(), expected){
+		t.Fatalf("Expected: %s, Got: %s", expected, b.String())
+	}
+}
+
+func TestMetricsTransportsShareRegistry(t *testing.T){
+	ts := startTestHTTPServer()
+	defer ts.Close()
+
+	reg := NewRegistry()
+	for i := 0; i < 2; i++{
+		client := createClientWithMetrics(5 *time.Second, reg)
+		resp, err := client.Get(ts.URL)
+		if err != nil{
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	var b strings.Builder
+	reg.WritePrometheus(&b)
+	if n := strings.Count(b.String(), "# TYPE http_client_requests_total counter"); n != 1{
+		t.Errorf("Expected the requests family to be written once, Got: %d\n%s", n, b.String())
+	}
+	u, _ := url.Parse(ts.URL)
+	expected := fmt.Sprintf(`http_client_requests_total{host="%s",method="GET",code="2xx"} 2`, u.Host)
+	if !strings.Contains(b.String(), expected+"\n"){
+		t.Errorf("Expected the requests of both clients in one series: %s\nGot:\n%s", expected, b.String())
+	}
+
+	defer func(){
+		if recover() == nil{
+			t.Error("Expected a panic for a name registered with other labels")
+		}
+	}()
+	reg.NewCounterVec("http_client_requests_total", "Requests sent.", "host")
+}
@@ -0,0 +1,255 @@
+/*
+	The connection-pooling example prints every httptrace event, which is
+	fine to see what happens for one request but useless to judge whether
+	MaxIdleConnsPerHost and IdleConnTimeout are tuned right for real traffic.
+
+	The Collector attaches the same kind of httptrace.ClientTrace to every
+	request made through a client and aggregates, per host:
+
+		- new vs reused connections (GotConnInfo.Reused)
+		- how long a reused connection sat idle in the pool (GotConnInfo.IdleTime)
+		- PutIdleConn failures, i.e. connections that could not go back into the
+		  pool (pool full, connection closed by the server...)
+		- DNS lookup and TCP connect durations
+
+	A high number of new connections with PutIdleConn failures means the pool
+	is too small, a lot of new connections with idle times close to
+	IdleConnTimeout means the time-out is too short.
+
+*/
+
+package poolstats
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// DurationStats summarises a series of durations.
+type DurationStats struct{
+	Count	int
+	Total	time.Duration
+	Max		time.Duration
+}
+
+func (d *DurationStats) add(v time.Duration){
+	d.Count++
+	d.Total += v
+	if v > d.Max{
+		d.Max = v
+	}
+}
+
+func (d DurationStats) Mean() time.Duration{
+	if d.Count == 0{
+		return 0
+	}
+	return d.Total / time.Duration(d.Count)
+}
+
+// HostStats are the pool statistics of one host (host:port as in the request URL).
+type HostStats struct{
+	Host				string
+	Requests			int
+	NewConns			int
+	ReusedConns			int
+	// IdleBeforeReuse is recorded for reused connections that were sitting in the idle pool.
+	IdleBeforeReuse		DurationStats
+	PutIdleOK			int
+	PutIdleFailures		int
+	// PutIdleErrors counts the failures by error message.
+	PutIdleErrors		map[string]int
+	DNS					DurationStats
+	DNSFailures			int
+	Connect				DurationStats
+	ConnectFailures		int
+}
+
+// ReuseRatio is the share of requests that got a pooled connection.
+func (h HostStats) ReuseRatio() float64{
+	total := h.NewConns + h.ReusedConns
+	if total == 0{
+		return 0
+	}
+	return float64(h.ReusedConns) / float64(total)
+}
+
+type Collector struct{
+	mu		sync.Mutex
+	hosts	map[string]*HostStats
+}
+
+func NewCollector() *Collector{
+	return &Collector{hosts: map[string]*HostStats{}}
+}
+
+// update runs f on the stats of host while holding the lock.
+func (c *Collector) update(host string, f func(h *HostStats)){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.hosts[host]
+	if !ok{
+		h = &HostStats{Host: host, PutIdleErrors: map[string]int{}}
+		c.hosts[host] = h
+	}
+	f(h)
+}
+
+// ClientTrace returns the hooks recording into the stats of host.
+// Use it directly with httptrace.WithClientTrace, or let Transport attach it for you.
+func (c *Collector) ClientTrace(host string) *httptrace.ClientTrace{
+	var mu sync.Mutex
+	var dnsStart time.Time
+	// with happy eyeballs, several connects can be in flight at once
+	connectStart := map[string]time.Time{}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			d := time.Since(dnsStart)
+			mu.Unlock()
+			c.update(host, func(h *HostStats) {
+				h.DNS.add(d)
+				if info.Err != nil{
+					h.DNSFailures++
+				}
+			})
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connectStart[network+addr] = time.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			d := time.Since(connectStart[network+addr])
+			mu.Unlock()
+			c.update(host, func(h *HostStats) {
+				h.Connect.add(d)
+				if err != nil{
+					h.ConnectFailures++
+				}
+			})
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.update(host, func(h *HostStats) {
+				if info.Reused{
+					h.ReusedConns++
+				}else{
+					h.NewConns++
+				}
+				if info.WasIdle{
+					h.IdleBeforeReuse.add(info.IdleTime)
+				}
+			})
+		},
+		PutIdleConn: func(err error) {
+			c.update(host, func(h *HostStats) {
+				if err != nil{
+					h.PutIdleFailures++
+					h.PutIdleErrors[err.Error()]++
+				}else{
+					h.PutIdleOK++
+				}
+			})
+		},
+	}
+}
+
+// Transport wraps next (http.DefaultTransport if nil) so every request is recorded.
+func (c *Collector) Transport(next http.RoundTripper) http.RoundTripper{
+	if next == nil{
+		next = http.DefaultTransport
+	}
+	return &collectingTransport{c: c, next: next}
+}
+
+// Instrument replaces the client's transport with one recording into c.
+func (c *Collector) Instrument(client *http.Client){
+	client.Transport = c.Transport(client.Transport)
+}
+
+type collectingTransport struct{
+	c		*Collector
+	next	http.RoundTripper
+}
+
+func (t *collectingTransport) RoundTrip(r *http.Request)(*http.Response, error){
+	host := r.URL.Host
+	t.c.update(host, func(h *HostStats) { h.Requests++ })
+	ctx := httptrace.WithClientTrace(r.Context(), t.c.ClientTrace(host))
+	return t.next.RoundTrip(r.Clone(ctx))
+}
+
+// Snapshot returns a copy of the statistics, sorted by host.
+func (c *Collector) Snapshot() []HostStats{
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make([]HostStats, 0, len(c.hosts))
+	for _, h := range c.hosts{
+		s := *h
+		s.PutIdleErrors = make(map[string]int, len(h.PutIdleErrors))
+		for k, v := range h.PutIdleErrors{
+			s.PutIdleErrors[k] = v
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Host < stats[j].Host })
+	return stats
+}
+
+// Reset forgets everything collected so far.
+func (c *Collector) Reset(){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hosts = map[string]*HostStats{}
+}
+
+// WriteReport writes the current snapshot as a table.
+func (c *Collector) WriteReport(w io.Writer) error{
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tREQUESTS\tNEW\tREUSED\tREUSE%\tIDLE(avg/max)\tPUTIDLE FAIL\tDNS(avg/max)\tCONNECT(avg/max)")
+	for _, h := range c.Snapshot(){
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.1f\t%s/%s\t%d\t%s/%s\t%s/%s\n",
+			h.Host, h.Requests, h.NewConns, h.ReusedConns, h.ReuseRatio()*100,
+			h.IdleBeforeReuse.Mean().Round(time.Millisecond), h.IdleBeforeReuse.Max.Round(time.Millisecond),
+			h.PutIdleFailures,
+			h.DNS.Mean().Round(time.Microsecond), h.DNS.Max.Round(time.Microsecond),
+			h.Connect.Mean().Round(time.Microsecond), h.Connect.Max.Round(time.Microsecond),
+		)
+	}
+	return tw.Flush()
+}
+
+// ReportEvery writes a report to w every interval until ctx is cancelled.
+// It runs in its own goroutine, the returned channel is closed once it stopped.
+func (c *Collector) ReportEvery(ctx context.Context, interval time.Duration, w io.Writer) <-chan struct{}{
+	done := make(chan struct{})
+	go func(){
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for{
+			select{
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.WriteReport(w)
+				fmt.Fprintln(w, "----------------------")
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,139 @@
+package poolstats
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startTestHTTPServer(h http.HandlerFunc) (*httptest.Server, string){
+	ts := httptest.NewServer(h)
+	u, _ := url.Parse(ts.URL)
+	return ts, u.Host
+}
+
+func get(client *http.Client, url string) error{
+	resp, err := client.Get(url)
+	if err != nil{
+		return err
+	}
+	io.ReadAll(resp.Body)
+	return resp.Body.Close()
+}
+
+func TestCollectorNewAndReused(t *testing.T){
+	ts, host := startTestHTTPServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello World")
+	})
+	defer ts.Close()
+
+	c := NewCollector()
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 1}}
+	c.Instrument(client)
+
+	for i := 0; i < 5; i++{
+		if err := get(client, ts.URL); err != nil{
+			t.Fatal(err)
+		}
+	}
+
+	stats := c.Snapshot()
+	if len(stats) != 1 || stats[0].Host != host{
+		t.Fatalf("Expected stats for %s only, Got: %+v", host, stats)
+	}
+	s := stats[0]
+	if s.Requests != 5 || s.NewConns != 1 || s.ReusedConns != 4{
+		t.Errorf("Expected 5 requests, 1 new and 4 reused connections, Got: %d, %d, %d", s.Requests, s.NewConns, s.ReusedConns)
+	}
+	if s.IdleBeforeReuse.Count != 4{
+		t.Errorf("Expected 4 idle durations, Got: %d", s.IdleBeforeReuse.Count)
+	}
+	if s.PutIdleOK != 5 || s.PutIdleFailures != 0{
+		t.Errorf("Expected 5 connections returned to the pool, Got: %d ok, %d failures", s.PutIdleOK, s.PutIdleFailures)
+	}
+	if s.Connect.Count != 1{
+		t.Errorf("Expected 1 connect, Got: %d", s.Connect.Count)
+	}
+}
+
+func TestCollectorPutIdleFailure(t *testing.T){
+	// the handler waits until both requests arrived, so two connections are needed
+	var wg sync.WaitGroup
+	wg.Add(2)
+	ts, _ := startTestHTTPServer(func(w http.ResponseWriter, r *http.Request) {
+		wg.Done()
+		wg.Wait()
+		fmt.Fprint(w, "Hello World")
+	})
+	defer ts.Close()
+
+	c := NewCollector()
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 1}}
+	c.Instrument(client)
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++{
+		go func(){
+			errs <- get(client, ts.URL)
+		}()
+	}
+	for i := 0; i < 2; i++{
+		if err := <-errs; err != nil{
+			t.Fatal(err)
+		}
+	}
+
+	s := c.Snapshot()[0]
+	if s.NewConns != 2{
+		t.Errorf("Expected 2 new connections, Got: %d", s.NewConns)
+	}
+	// only one of the two connections fits in the idle pool
+	if s.PutIdleOK != 1 || s.PutIdleFailures != 1{
+		t.Errorf("Expected 1 connection pooled and 1 rejected, Got: %d ok, %d failures", s.PutIdleOK, s.PutIdleFailures)
+	}
+}
+
+func TestCollectorReportEvery(t *testing.T){
+	ts, host := startTestHTTPServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello World")
+	})
+	defer ts.Close()
+
+	c := NewCollector()
+	client := &http.Client{}
+	c.Instrument(client)
+	if err := get(client, ts.URL); err != nil{
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var b bytes.Buffer
+	w := writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return b.Write(p)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50 *time.Millisecond)
+	defer cancel()
+	<-c.ReportEvery(ctx, 10 *time.Millisecond, w)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.Contains(b.String(), host){
+		t.Fatalf("Expected the report to mention %s, Got: %s", host, b.String())
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error){
+	return f(p)
+}
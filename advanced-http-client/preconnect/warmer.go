@@ -0,0 +1,411 @@
+/*
+	The first request to a host pays for DNS, the TCP handshake and the TLS
+	handshake (see the notes in connection-pooling). For latency sensitive
+	jobs we would rather pay that before the real work starts.
+
+	http.Transport has no API to add a connection to its idle pool, but it
+	puts every connection back there once a response is done. So to park N
+	connections for a host, the Warmer sends N requests at the same time and
+	holds each one in the GotConn hook until all N have a connection: none of
+	them can be handed a connection another one already opened, so N
+	distinct connections are dialed. Then the requests complete and the N
+	connections go to the idle pool.
+
+	N is capped by MaxIdleConnsPerHost, anything above would be closed right
+	away, and by MaxConnsPerHost, the requests above it would wait for a
+	connection that is never dialed and hold the barrier until the timeout.
+	With HTTP/2 a single connection is multiplexed, one is enough.
+
+	The Warmer also remembers the warmed connections: every later request
+	made through the client is checked in GotConn, so Stats tells whether the
+	warm-up actually paid off or the connections were closed before use.
+	The dialer of the transport is wrapped so that a closed connection is
+	forgotten, the Warmer does not keep every connection it ever opened.
+	Because of this the default transport is cloned rather than modified.
+
+	DialTLSContext is not wrapped: http.Transport reads the TLS state (and
+	negotiates HTTP/2) only when the dialer returns a *tls.Conn, a wrapper
+	would leave resp.TLS nil. Its connections are followed through the
+	request traces instead: forgotten when the transport does not put them
+	back in the pool (PutIdleConn with an error), when they stayed idle
+	longer than IdleConnTimeout, or when the client's CloseIdleConnections
+	is called. An HTTP/2 connection counts as idle from its last use.
+
+*/
+
+package preconnect
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of the warm-up of one origin.
+type Result struct{
+	Origin		string
+	// Requested is the pool size asked for, Target the size after applying MaxIdleConnsPerHost and MaxConnsPerHost.
+	Requested	int
+	Target		int
+	// Opened is the number of new connections dialed.
+	Opened		int
+	Err			error
+}
+
+// Stats tells how the warmed connections were used by the requests that followed.
+type Stats struct{
+	Warmed		int
+	// WarmedUsed is the number of distinct warmed connections used at least once.
+	WarmedUsed	int
+	// WarmReuses counts the requests served on a warmed connection.
+	WarmReuses	int
+	// ColdDials counts the requests that had to dial a new connection anyway.
+	ColdDials	int
+	// OtherReuses counts the requests served on a pooled connection the Warmer did not open.
+	OtherReuses	int
+}
+
+type Warmer struct{
+	client		*http.Client
+	transport	*http.Transport
+	// Method and Path of the warm-up requests, HEAD / by default.
+	Method		string
+	Path		string
+	// Timeout bounds the warm-up of one origin.
+	Timeout		time.Duration
+
+	mu			sync.Mutex
+	warmed		map[net.Conn]*warmConn
+	stats		Stats
+}
+
+type warmConn struct{
+	// used at least once after the warm-up
+	used		bool
+	// idleSince is zero while a request uses the connection
+	idleSince	time.Time
+}
+
+type warmupKey struct{}
+
+// NewWarmer wraps the client's transport so later requests can be matched with the warmed connections.
+// The client must use an *http.Transport (or the default one), its dialers are wrapped: call NewWarmer
+// before the client is used.
+func NewWarmer(client *http.Client) (*Warmer, error){
+	rt := client.Transport
+	if rt == nil{
+		rt = http.DefaultTransport
+	}
+	t, ok := rt.(*http.Transport)
+	if !ok{
+		return nil, fmt.Errorf("preconnect: client transport must be an *http.Transport, got %T", rt)
+	}
+	//the dialers are replaced below, the default transport is shared by every client of the program
+	if t == http.DefaultTransport{
+		t = t.Clone()
+	}
+	w := &Warmer{
+		client:		client,
+		transport:	t,
+		Method:		http.MethodHead,
+		Path:		"/",
+		Timeout:	10 *time.Second,
+		warmed:		map[net.Conn]*warmConn{},
+	}
+	w.wrapDialers()
+	client.Transport = &trackingTransport{w: w, next: t}
+	return w, nil
+}
+
+// closeHookConn calls onClose the first time the connection is closed.
+type closeHookConn struct{
+	net.Conn
+	once	sync.Once
+	onClose	func(net.Conn)
+}
+
+func (c *closeHookConn) Close() error{
+	c.once.Do(func(){ c.onClose(c) })
+	return c.Conn.Close()
+}
+
+// wrapDialers makes every connection of the transport forget itself in warmed when it is closed.
+// The connections of DialTLSContext are left as they are, see trackIdle.
+func (w *Warmer) wrapDialers(){
+	t := w.transport
+	hook := func(c net.Conn, err error) (net.Conn, error){
+		if err != nil{
+			return nil, err
+		}
+		return &closeHookConn{Conn: c, onClose: w.forget}, nil
+	}
+	dial := t.DialContext
+	if dial == nil && t.Dial != nil{
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error){
+			return t.Dial(network, addr)
+		}
+	}
+	if dial == nil{
+		//the dialer http.Transport uses when DialContext is nil
+		dial = (&net.Dialer{Timeout: 30 *time.Second, KeepAlive: 30 *time.Second}).DialContext
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error){
+		return hook(dial(ctx, network, addr))
+	}
+}
+
+// trackIdle adds to trace the hooks that follow whether the connection of the request is busy or idle,
+// and forgets it when the transport closes it instead of putting it back in the pool. done must be
+// called with the outcome of the request: the transport closes the connection after an error or a
+// "Connection: close" without calling PutIdleConn.
+func (w *Warmer) trackIdle(trace *httptrace.ClientTrace) (*httptrace.ClientTrace, func(*http.Response, error)){
+	var conn net.Conn
+	gotConn := trace.GotConn
+	trace.GotConn = func(info httptrace.GotConnInfo) {
+		w.mu.Lock()
+		conn = connKey(info.Conn)
+		if wc, ok := w.warmed[conn]; ok{
+			wc.idleSince = time.Time{}
+			//no PutIdleConn for HTTP/2, the connection stays in the pool while it is open
+			if tc, ok := info.Conn.(*tls.Conn); ok && tc.ConnectionState().NegotiatedProtocol == "h2"{
+				wc.idleSince = time.Now()
+			}
+		}
+		w.mu.Unlock()
+		gotConn(info)
+	}
+	trace.PutIdleConn = func(err error) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		wc, ok := w.warmed[conn]
+		switch{
+		case !ok:
+		case err != nil:
+			delete(w.warmed, conn)
+		default:
+			wc.idleSince = time.Now()
+		}
+	}
+	done := func(resp *http.Response, err error){
+		if err == nil && !resp.Close{
+			return
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if conn != nil{
+			delete(w.warmed, conn)
+		}
+	}
+	return trace, done
+}
+
+// prune forgets the connections idle for longer than IdleConnTimeout, the transport closed them. w.mu must be held.
+func (w *Warmer) prune(){
+	timeout := w.transport.IdleConnTimeout
+	if timeout <= 0{
+		return
+	}
+	for c, wc := range w.warmed{
+		if !wc.idleSince.IsZero() && time.Since(wc.idleSince) > timeout{
+			delete(w.warmed, c)
+		}
+	}
+}
+
+func (w *Warmer) forget(c net.Conn){
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.warmed, c)
+}
+
+// connKey returns the connection the dialer returned, under the TLS layer added by the transport.
+func connKey(c net.Conn) net.Conn{
+	if tc, ok := c.(interface{ NetConn() net.Conn }); ok{
+		return tc.NetConn()
+	}
+	return c
+}
+
+// poolLimit is the number of connections the transport keeps idle, and can open, per host.
+func (w *Warmer) poolLimit() int{
+	limit := http.DefaultMaxIdleConnsPerHost
+	if w.transport.MaxIdleConnsPerHost > 0{
+		limit = w.transport.MaxIdleConnsPerHost
+	}
+	if max := w.transport.MaxConnsPerHost; max > 0 && max < limit{
+		limit = max
+	}
+	return limit
+}
+
+// Preconnect warms every origin (scheme://host[:port]) in parallel.
+func (w *Warmer) Preconnect(ctx context.Context, origins []string, poolSize int) []Result{
+	results := make([]Result, len(origins))
+	var wg sync.WaitGroup
+	for i, origin := range origins{
+		wg.Add(1)
+		go func(i int, origin string){
+			defer wg.Done()
+			results[i] = w.warm(ctx, origin, poolSize)
+		}(i, origin)
+	}
+	wg.Wait()
+	return results
+}
+
+// barrier releases everybody once n parties arrived.
+type barrier struct{
+	mu		sync.Mutex
+	n		int
+	release	chan struct{}
+}
+
+func (b *barrier) arrive(){
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.n--
+	if b.n == 0{
+		close(b.release)
+	}
+}
+
+func (w *Warmer) warm(ctx context.Context, origin string, poolSize int) Result{
+	r := Result{Origin: origin, Requested: poolSize, Target: poolSize}
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == ""{
+		r.Err = fmt.Errorf("preconnect: invalid origin %q", origin)
+		return r
+	}
+	if limit := w.poolLimit(); r.Target > limit{
+		r.Target = limit
+	}
+	if r.Target < 1{
+		return r
+	}
+	w.mu.Lock()
+	w.prune()
+	w.mu.Unlock()
+	u.Path = w.Path
+	target := u.String()
+
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	b := &barrier{n: r.Target, release: make(chan struct{})}
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	for i := 0; i < r.Target; i++{
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			var once sync.Once
+			arrive := func() { once.Do(b.arrive) }
+			// if the request fails before getting a connection, it must not hold the others
+			defer arrive()
+
+			trace, done := w.trackIdle(&httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) {
+					w.mu.Lock()
+					if !info.Reused{
+						r.Opened++
+						w.warmed[connKey(info.Conn)] = &warmConn{}
+					}
+					w.mu.Unlock()
+					arrive()
+					// hold this connection busy until every request has its own
+					select{
+					case <-b.release:
+					case <-ctx.Done():
+					}
+				},
+			})
+			reqCtx := httptrace.WithClientTrace(context.WithValue(ctx, warmupKey{}, true), trace)
+			req, err := http.NewRequestWithContext(reqCtx, w.Method, target, nil)
+			if err == nil{
+				var resp *http.Response
+				resp, err = w.client.Do(req)
+				done(resp, err)
+				if err == nil{
+					// read to EOF, so the connection goes back to the pool
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			}
+			if err != nil{
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	w.mu.Lock()
+	w.stats.Warmed += r.Opened
+	w.mu.Unlock()
+	r.Err = errors.Join(errs...)
+	return r
+}
+
+// Stats returns the usage of the warmed connections so far.
+func (w *Warmer) Stats() Stats{
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+// trackingTransport checks every request that is not a warm-up against the warmed connections.
+type trackingTransport struct{
+	w		*Warmer
+	next	http.RoundTripper
+}
+
+func (t *trackingTransport) RoundTrip(r *http.Request)(*http.Response, error){
+	if r.Context().Value(warmupKey{}) != nil{
+		return t.next.RoundTrip(r)
+	}
+	trace, done := t.w.trackIdle(&httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.w.mu.Lock()
+			defer t.w.mu.Unlock()
+			t.w.prune()
+			wc, warm := t.w.warmed[connKey(info.Conn)]
+			switch{
+			case warm:
+				t.w.stats.WarmReuses++
+				if !wc.used{
+					wc.used = true
+					t.w.stats.WarmedUsed++
+				}
+			case !info.Reused:
+				t.w.stats.ColdDials++
+			default:
+				t.w.stats.OtherReuses++
+			}
+		},
+	})
+	resp, err := t.next.RoundTrip(r.Clone(httptrace.WithClientTrace(r.Context(), trace)))
+	done(resp, err)
+	return resp, err
+}
+
+// CloseIdleConnections is called by the client's CloseIdleConnections, the idle warmed connections are forgotten.
+func (t *trackingTransport) CloseIdleConnections(){
+	t.w.transport.CloseIdleConnections()
+	t.w.mu.Lock()
+	defer t.w.mu.Unlock()
+	for c, wc := range t.w.warmed{
+		if !wc.idleSince.IsZero(){
+			delete(t.w.warmed, c)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package preconnect
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startTestHTTPServer counts the connections it accepts.
+func startTestHTTPServer(h http.HandlerFunc) (*httptest.Server, *atomic.Int64){
+	var conns atomic.Int64
+	ts := httptest.NewUnstartedServer(h)
+	ts.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew{
+			conns.Add(1)
+		}
+	}
+	ts.Start()
+	return ts, &conns
+}
+
+func TestPreconnectWarmsPool(t *testing.T){
+	// the handler waits for 3 requests, so they need 3 connections at once
+	var wg sync.WaitGroup
+	wg.Add(3)
+	ts, conns := startTestHTTPServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET"{
+			wg.Done()
+			wg.Wait()
+		}
+		fmt.Fprint(w, "Hello World")
+	})
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 3}}
+	warmer, err := NewWarmer(client)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	results := warmer.Preconnect(context.Background(), []string{ts.URL}, 5)
+	r := results[0]
+	if r.Err != nil{
+		t.Fatal(r.Err)
+	}
+	if r.Target != 3 || r.Opened != 3{
+		t.Fatalf("Expected the pool size to be capped at 3 and 3 connections opened, Got: target %d, opened %d", r.Target, r.Opened)
+	}
+	if conns.Load() != 3{
+		t.Fatalf("Expected the server to see 3 connections, Got: %d", conns.Load())
+	}
+
+	var done sync.WaitGroup
+	for i := 0; i < 3; i++{
+		done.Add(1)
+		go func(){
+			defer done.Done()
+			resp, err := client.Get(ts.URL)
+			if err != nil{
+				t.Error(err)
+				return
+			}
+			io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	done.Wait()
+
+	s := warmer.Stats()
+	if s.Warmed != 3 || s.WarmedUsed != 3 || s.WarmReuses != 3 || s.ColdDials != 0{
+		t.Errorf("Expected the 3 requests to use the 3 warmed connections, Got: %+v", s)
+	}
+	if conns.Load() != 3{
+		t.Errorf("Expected no new connection after the warm-up, Got: %d", conns.Load())
+	}
+}
+
+func TestPreconnectColdDial(t *testing.T){
+	ts, _ := startTestHTTPServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello World")
+	})
+	defer ts.Close()
+
+	transport := &http.Transport{MaxIdleConnsPerHost: 2}
+	client := &http.Client{Transport: transport}
+	warmer, err := NewWarmer(client)
+	if err != nil{
+		t.Fatal(err)
+	}
+	warmer.Preconnect(context.Background(), []string{ts.URL}, 2)
+
+	// the warmed connections are gone, the next request dials again
+	transport.CloseIdleConnections()
+	resp, err := client.Get(ts.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	s := warmer.Stats()
+	if s.Warmed != 2 || s.WarmedUsed != 0 || s.ColdDials != 1{
+		t.Errorf("Expected the warm-up to be wasted, Got: %+v", s)
+	}
+	warmer.mu.Lock()
+	defer warmer.mu.Unlock()
+	if len(warmer.warmed) != 0{
+		t.Errorf("Expected the closed connections to be forgotten, Got: %d", len(warmer.warmed))
+	}
+}
+
+func TestPreconnectMaxConnsPerHost(t *testing.T){
+	ts, conns := startTestHTTPServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello World")
+	})
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: 5, MaxConnsPerHost: 2}}
+	warmer, err := NewWarmer(client)
+	if err != nil{
+		t.Fatal(err)
+	}
+	// the third request could never get a connection, the warm-up would last until the timeout
+	warmer.Timeout = 2 *time.Second
+	start := time.Now()
+	r := warmer.Preconnect(context.Background(), []string{ts.URL}, 5)[0]
+	if r.Err != nil{
+		t.Fatal(r.Err)
+	}
+	if r.Target != 2 || r.Opened != 2 || conns.Load() != 2{
+		t.Errorf("Expected the pool size to be capped at 2 and 2 connections opened, Got: target %d, opened %d", r.Target, r.Opened)
+	}
+	if time.Since(start) > time.Second{
+		t.Errorf("Expected the warm-up not to wait for the timeout, Got: %v", time.Since(start))
+	}
+}
+
+func TestPreconnectErrors(t *testing.T){
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	client := &http.Client{Transport: &http.Transport{}}
+	warmer, err := NewWarmer(client)
+	if err != nil{
+		t.Fatal(err)
+	}
+	warmer.Timeout = time.Second
+	results := warmer.Preconnect(context.Background(), []string{"http://" + addr, "not a url"}, 2)
+	for _, r := range results{
+		if r.Err == nil{
+			t.Errorf("Expected an error for %s, Got nil", r.Origin)
+		}
+	}
+
+	if _, err := NewWarmer(&http.Client{Transport: http.NewFileTransport(http.Dir("."))}); err == nil{
+		t.Error("Expected an error for a transport that is not an *http.Transport")
+	}
+}
+
+func TestPreconnectDialTLS(t *testing.T){
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello World")
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	// a dialer doing the TLS handshake itself, its *tls.Conn must reach the transport as it is
+	tlsConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	client := &http.Client{Transport: &http.Transport{
+		ForceAttemptHTTP2:	true,
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, network, addr)
+		},
+	}}
+	warmer, err := NewWarmer(client)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if r := warmer.Preconnect(context.Background(), []string{ts.URL}, 1)[0]; r.Err != nil || r.Opened != 1{
+		t.Fatalf("Expected 1 connection opened, Got: %d, %v", r.Opened, r.Err)
+	}
+
+	resp, err := client.Get(ts.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.TLS == nil || resp.ProtoMajor != 2{
+		t.Errorf("Expected an HTTP/2 response with its TLS state, Got: %s, TLS %v", resp.Proto, resp.TLS != nil)
+	}
+	if s := warmer.Stats(); s.WarmReuses != 1 || s.ColdDials != 0{
+		t.Errorf("Expected the request to use the warmed connection, Got: %+v", s)
+	}
+
+	// the connection is not wrapped, closing it through the client must still forget it
+	client.CloseIdleConnections()
+	warmer.mu.Lock()
+	defer warmer.mu.Unlock()
+	if len(warmer.warmed) != 0{
+		t.Errorf("Expected the closed connection to be forgotten, Got: %d", len(warmer.warmed))
+	}
+}
+
+func TestPreconnectDialTLSPutIdleError(t *testing.T){
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello World")
+	}))
+	defer ts.Close()
+
+	tlsConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig
+	client := &http.Client{Transport: &http.Transport{
+		MaxIdleConnsPerHost:	2,
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, network, addr)
+		},
+	}}
+	warmer, err := NewWarmer(client)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if r := warmer.Preconnect(context.Background(), []string{ts.URL}, 2)[0]; r.Err != nil || r.Opened != 2{
+		t.Fatalf("Expected 2 connections opened, Got: %d, %v", r.Opened, r.Err)
+	}
+	// one idle connection per host from now on: the second one is closed when its request is done
+	warmer.transport.MaxIdleConnsPerHost = 1
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++{
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			resp, err := client.Get(ts.URL)
+			if err != nil{
+				t.Error(err)
+				return
+			}
+			if resp.TLS == nil{
+				t.Error("Expected the TLS state of the response")
+			}
+			io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	warmer.mu.Lock()
+	defer warmer.mu.Unlock()
+	if len(warmer.warmed) > 1{
+		t.Errorf("Expected the connection the pool did not take back to be forgotten, Got: %d", len(warmer.warmed))
+	}
+}
+
+func TestPreconnectDialTLSConnectionClose(t *testing.T){
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET"{
+			w.Header().Set("Connection", "close")
+		}
+		fmt.Fprint(w, "Hello World")
+	}))
+	defer ts.Close()
+
+	tlsConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig
+	client := &http.Client{Transport: &http.Transport{
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, network, addr)
+		},
+	}}
+	warmer, err := NewWarmer(client)
+	if err != nil{
+		t.Fatal(err)
+	}
+	warmer.Preconnect(context.Background(), []string{ts.URL}, 1)
+
+	resp, err := client.Get(ts.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if s := warmer.Stats(); s.WarmReuses != 1{
+		t.Errorf("Expected the request to use the warmed connection, Got: %+v", s)
+	}
+	warmer.mu.Lock()
+	defer warmer.mu.Unlock()
+	if len(warmer.warmed) != 0{
+		t.Errorf("Expected the connection closed after the response to be forgotten, Got: %d", len(warmer.warmed))
+	}
+}
@@ -0,0 +1,46 @@
+/*
+	Fetch a URL with a chosen protocol and report the protocol used:
+
+		$ go run ./cmd/protocol-selection -proto h2c http://internal-service:8080/health
+		Got 200 over HTTP/2.0
+		...
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	protocolselection "github.com/Praveen005/Go-http-client/tree/main/advanced-http-client/protocol-selection"
+)
+
+func main(){
+	proto := flag.String("proto", "h2", "protocol to use: http1, h2 or h2c")
+	flag.Parse()
+	if flag.NArg() != 1{
+		fmt.Fprintf(os.Stdout, "Usage: protocol-selection [-proto http1|h2|h2c] URL\n")
+		os.Exit(1)
+	}
+	p, err := protocolselection.ParseProtocol(*proto)
+	if err != nil{
+		fmt.Fprintf(os.Stdout, "%v\n", err)
+		os.Exit(1)
+	}
+
+	client := protocolselection.CreateHTTPClientWithProtocol(15 *time.Second, p)
+	result, err := protocolselection.FetchRemoteResource(client, flag.Arg(0))
+	if err != nil{
+		fmt.Fprintf(os.Stdout, "%#v", err)
+		os.Exit(1)
+	}
+	if result.ALPN != ""{
+		fmt.Fprintf(os.Stdout, "Got %d over %s (ALPN: %s)\n", result.Status, result.Proto, result.ALPN)
+	}else{
+		fmt.Fprintf(os.Stdout, "Got %d over %s\n", result.Status, result.Proto)
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", result.Data)
+}
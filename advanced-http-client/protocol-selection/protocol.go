@@ -0,0 +1,116 @@
+/*
+	The logging middleware prints r.Proto, but the client never chooses it:
+	the DefaultTransport offers HTTP/2 to TLS servers through ALPN and
+	falls back to HTTP/1.1, and always speaks HTTP/1.1 in cleartext.
+
+	Since Go 1.24, Transport.Protocols says which protocols may be used
+	(that is why this module needs go 1.24 in go.mod):
+
+		http1	HTTP/1.1 only, also over TLS (ALPN offers http/1.1 only).
+				For servers or proxies with a broken HTTP/2.
+		h2		HTTP/2 over TLS when the server agrees through ALPN, HTTP/1.1
+				otherwise and in cleartext. What DefaultTransport does, but
+				kept with a custom TLS configuration, which would disable
+				HTTP/2 unless ForceAttemptHTTP2 is set.
+		h2c		HTTP/2 everywhere: with "prior knowledge" in cleartext (no
+				Upgrade dance, the client starts right away with the HTTP/2
+				preface), and through ALPN over TLS. Only for servers known
+				to support it, typically internal services behind a load
+				balancer terminating TLS. A server speaking only HTTP/1.1
+				fails instead of falling back.
+
+	The protocol actually used is in Response.Proto, and the ALPN outcome
+	in Response.TLS.NegotiatedProtocol; FetchRemoteResource reports both.
+
+	cmd/protocol-selection is a small fetch command built on this package.
+
+*/
+
+package protocolselection
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type Protocol string
+
+const (
+	HTTP1	Protocol	= "http1"
+	HTTP2	Protocol	= "h2"
+	H2C		Protocol	= "h2c"
+)
+
+func ParseProtocol(s string) (Protocol, error){
+	switch p := Protocol(s); p{
+	case HTTP1, HTTP2, H2C:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown protocol %q, expected one of http1, h2, h2c", s)
+}
+
+func (p Protocol) protocols() *http.Protocols{
+	var protocols http.Protocols
+	switch p{
+	case HTTP1:
+		protocols.SetHTTP1(true)
+	case HTTP2:
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	case H2C:
+		// without HTTP1, http:// URLs use unencrypted HTTP/2
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	return &protocols
+}
+
+// NewTransport clones base (http.DefaultTransport if nil) and restricts it to the protocols of p.
+func NewTransport(p Protocol, base *http.Transport) *http.Transport{
+	if base == nil{
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	transport := base.Clone()
+	transport.Protocols = p.protocols()
+	if transport.TLSClientConfig != nil{
+		// ALPN offers would still come from the base config (e.g. "h2" with http1),
+		// the transport fills them from Protocols when empty
+		transport.TLSClientConfig.NextProtos = nil
+	}
+	return transport
+}
+
+// CreateHTTPClientWithProtocol returns a client restricted to the protocols of p.
+func CreateHTTPClientWithProtocol(d time.Duration, p Protocol) *http.Client{
+	client := http.Client{Timeout: d, Transport: NewTransport(p, nil)}
+	return &client
+}
+
+type FetchResult struct{
+	Data	[]byte
+	Status	int
+	// Proto is the protocol of the response, "HTTP/1.1" or "HTTP/2.0".
+	Proto	string
+	// ALPN is the protocol negotiated during the TLS handshake, empty in cleartext.
+	ALPN	string
+}
+
+func FetchRemoteResource(client *http.Client, url string)(*FetchResult, error){
+	r, err := client.Get(url)
+	if err != nil{
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil{
+		return nil, err
+	}
+	result := &FetchResult{Data: data, Status: r.StatusCode, Proto: r.Proto}
+	if r.TLS != nil{
+		result.ALPN = r.TLS.NegotiatedProtocol
+	}
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package protocolselection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func handler(w http.ResponseWriter, r *http.Request){
+	// the server tells which protocol it saw
+	fmt.Fprint(w, r.Proto)
+}
+
+// startH2CServer returns a cleartext server speaking HTTP/1.1 and HTTP/2 with prior knowledge.
+func startH2CServer() *httptest.Server{
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	ts.Config.Protocols = &protocols
+	ts.Start()
+	return ts
+}
+
+func startTLSServer() *httptest.Server{
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(handler))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	return ts
+}
+
+func fetch(t *testing.T, client *http.Client, url string) *FetchResult{
+	t.Helper()
+	result, err := FetchRemoteResource(client, url)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if string(result.Data) != result.Proto{
+		t.Errorf("Expected the server to see %s, Got: %s", result.Proto, result.Data)
+	}
+	return result
+}
+
+func TestCleartext(t *testing.T){
+	ts := startH2CServer()
+	defer ts.Close()
+
+	for p, expected := range map[Protocol]string{
+		HTTP1:	"HTTP/1.1",
+		HTTP2:	"HTTP/1.1",
+		H2C:	"HTTP/2.0",
+	}{
+		result := fetch(t, CreateHTTPClientWithProtocol(5 *time.Second, p), ts.URL)
+		if result.Proto != expected || result.ALPN != ""{
+			t.Errorf("Expected %s with %s in cleartext, Got: %s (ALPN %q)", expected, p, result.Proto, result.ALPN)
+		}
+	}
+}
+
+func TestH2CNeedsServerSupport(t *testing.T){
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+
+	client := CreateHTTPClientWithProtocol(5 *time.Second, H2C)
+	if _, err := FetchRemoteResource(client, ts.URL); err == nil{
+		t.Fatal("Expected h2c to fail against an HTTP/1.1 only server")
+	}
+}
+
+func TestTLS(t *testing.T){
+	ts := startTLSServer()
+	defer ts.Close()
+	// a bare transport trusting the test server: ts.Client() would already force HTTP/2
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	base := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+
+	for p, expected := range map[Protocol]string{
+		HTTP1:	"HTTP/1.1",
+		HTTP2:	"HTTP/2.0",
+		H2C:	"HTTP/2.0",
+	}{
+		client := &http.Client{Timeout: 5 *time.Second, Transport: NewTransport(p, base)}
+		result := fetch(t, client, ts.URL)
+		if result.Proto != expected{
+			t.Errorf("Expected %s with %s over TLS, Got: %s", expected, p, result.Proto)
+		}
+		if expected == "HTTP/2.0" && result.ALPN != "h2"{
+			t.Errorf("Expected ALPN h2 with %s, Got: %q", p, result.ALPN)
+		}
+	}
+}
+
+func TestParseProtocol(t *testing.T){
+	if _, err := ParseProtocol("h3"); err == nil{
+		t.Error("Expected an error for h3")
+	}
+	if p, err := ParseProtocol("h2c"); err != nil || p != H2C{
+		t.Errorf("Expected h2c, Got: %v, %v", p, err)
+	}
+}
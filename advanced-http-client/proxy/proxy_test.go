@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProxyFor(t *testing.T){
+	c := &Config{
+		NoProxy: "localhost, .internal.example.com, 192.168.0.0/16, example.org:8080",
+		Rules: []Rule{
+			{Pattern: "*.registry.example.com", Proxy: "socks5://socks:1080"},
+			{Pattern: "10.0.0.0/8", Proxy: "http://corp:3128"},
+			{Pattern: "public.example.com", Proxy: Direct},
+		},
+		Default: "http://default:3128",
+	}
+	for rawURL, expected := range map[string]string{
+		"http://localhost/":						"",
+		"http://api.localhost/":					"",
+		"https://a.internal.example.com/":			"",
+		"https://internal.example.com/":			"http://default:3128",
+		"http://192.168.1.10/":						"",
+		"http://example.org:8080/":					"",
+		"http://example.org/":						"http://default:3128",
+		"https://eu.registry.example.com/":			"socks5://socks:1080",
+		"http://10.1.2.3:9000/":					"http://corp:3128",
+		"http://public.example.com/":				"",
+		"http://other.example.com/":				"http://default:3128",
+	}{
+		u, _ := url.Parse(rawURL)
+		p, err := c.ProxyFor(u)
+		if err != nil{
+			t.Fatal(err)
+		}
+		got := ""
+		if p != nil{
+			got = p.String()
+		}
+		if got != expected{
+			t.Errorf("Expected proxy for %s to be %q, Got: %q", rawURL, expected, got)
+		}
+	}
+
+	bad := &Config{Default: "ftp://proxy:21"}
+	if _, err := bad.ProxyFor(&url.URL{Scheme: "http", Host: "example.com"}); err == nil{
+		t.Error("Expected an error for an unsupported proxy scheme")
+	}
+}
+
+func startTestHTTPServer() *httptest.Server{
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello World")
+	}))
+	return ts
+}
+
+func get(t *testing.T, rt http.RoundTripper, url string) (*http.Response, string){
+	t.Helper()
+	client := &http.Client{Timeout: 5 *time.Second, Transport: rt}
+	resp, err := client.Get(url)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+// startHeaderServer records the headers of the last request it got.
+func startHeaderServer() (*httptest.Server, func() http.Header){
+	var mu sync.Mutex
+	var last http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		last = r.Header.Clone()
+		mu.Unlock()
+		fmt.Fprint(w, "Hello World")
+	}))
+	return ts, func() http.Header{
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func TestHTTPForwardProxy(t *testing.T){
+	ts, received := startHeaderServer()
+	defer ts.Close()
+	p := NewHTTPProxy("user", "secret")
+	defer p.Close()
+
+	c := &Config{
+		Default:	p.ProxyURL(),
+		Headers:	map[string]http.Header{p.Listener.Addr().String(): {"Proxy-Token": {"abc"}, "X-Proxy-Tag": {"blue"}}},
+	}
+	_, body := get(t, NewTransport(c, nil), ts.URL+"/api/packages")
+	if body != "Hello World"{
+		t.Fatalf("Expected Hello World, Got: %s", body)
+	}
+
+	visits := p.Visits()
+	if len(visits) != 1 || visits[0].Method != "GET" || visits[0].Target != ts.URL+"/api/packages"{
+		t.Fatalf("Expected the proxy to forward GET %s/api/packages, Got: %+v", ts.URL, visits)
+	}
+	if visits[0].Header.Get("Proxy-Token") != "abc"{
+		t.Errorf("Expected the proxy header to be sent, Got: %v", visits[0].Header)
+	}
+	// the request itself goes on to the origin, only the Proxy-* headers are added to it
+	if visits[0].Header.Get("X-Proxy-Tag") != ""{
+		t.Errorf("Expected no other header on a plain http request, Got: %v", visits[0].Header)
+	}
+	if h := received(); h.Get("Proxy-Token") != "" || h.Get("X-Proxy-Tag") != "" || h.Get("Proxy-Authorization") != ""{
+		t.Errorf("Expected the origin not to receive the proxy headers, Got: %v", h)
+	}
+}
+
+func TestNoProxyGetsNoProxyHeaders(t *testing.T){
+	ts, received := startHeaderServer()
+	defer ts.Close()
+	p := NewHTTPProxy("", "")
+	defer p.Close()
+
+	c := &Config{
+		Default:	p.ProxyURL(),
+		NoProxy:	"127.0.0.1",
+		Headers:	map[string]http.Header{p.Listener.Addr().String(): {"Proxy-Token": {"abc"}}},
+	}
+	if _, body := get(t, NewTransport(c, nil), ts.URL); body != "Hello World"{
+		t.Fatalf("Expected Hello World, Got: %s", body)
+	}
+	if n := len(p.Visits()); n != 0{
+		t.Fatalf("Expected the proxy not to be used, Got: %d visits", n)
+	}
+	if h := received(); h.Get("Proxy-Token") != ""{
+		t.Errorf("Expected a bypassed host not to receive the proxy headers, Got: %v", h)
+	}
+}
+
+func TestHTTPProxyAuthRequired(t *testing.T){
+	ts := startTestHTTPServer()
+	defer ts.Close()
+	p := NewHTTPProxy("user", "secret")
+	defer p.Close()
+
+	u, _ := url.Parse(p.ProxyURL())
+	u.User = url.UserPassword("user", "wrong")
+	resp, _ := get(t, NewTransport(&Config{Default: u.String()}, nil), ts.URL)
+	if resp.StatusCode != http.StatusProxyAuthRequired{
+		t.Fatalf("Expected status 407, Got: %d", resp.StatusCode)
+	}
+}
+
+func TestHTTPSThroughConnect(t *testing.T){
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello TLS")
+	}))
+	defer ts.Close()
+	p := NewHTTPProxy("user", "secret")
+	defer p.Close()
+
+	c := &Config{
+		Default:	p.ProxyURL(),
+		Headers:	map[string]http.Header{p.Listener.Addr().String(): {"X-Proxy-Token": {"abc"}}},
+	}
+	// the test server certificate is only trusted by its own transport
+	base := ts.Client().Transport.(*http.Transport)
+	_, body := get(t, NewTransport(c, base), ts.URL)
+	if body != "Hello TLS"{
+		t.Fatalf("Expected Hello TLS, Got: %s", body)
+	}
+
+	visits := p.Visits()
+	if len(visits) != 1 || visits[0].Method != "CONNECT" || visits[0].Target != ts.Listener.Addr().String(){
+		t.Fatalf("Expected one CONNECT to %s, Got: %+v", ts.Listener.Addr(), visits)
+	}
+	if visits[0].Header.Get("X-Proxy-Token") != "abc" || !strings.HasPrefix(visits[0].Header.Get("Proxy-Authorization"), "Basic "){
+		t.Errorf("Expected the token and the credentials in the CONNECT request, Got: %v", visits[0].Header)
+	}
+}
+
+func TestSOCKS5Proxy(t *testing.T){
+	ts := startTestHTTPServer()
+	defer ts.Close()
+	p, err := NewSOCKS5Proxy("user", "secret")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	_, body := get(t, NewTransport(&Config{Default: p.ProxyURL()}, nil), ts.URL)
+	if body != "Hello World"{
+		t.Fatalf("Expected Hello World, Got: %s", body)
+	}
+	visits := p.Visits()
+	if len(visits) != 1 || visits[0].Target != ts.Listener.Addr().String(){
+		t.Fatalf("Expected one SOCKS5 connect to %s, Got: %+v", ts.Listener.Addr(), visits)
+	}
+
+	// wrong credentials are refused during the handshake
+	u, _ := url.Parse(p.ProxyURL())
+	u.User = url.UserPassword("user", "wrong")
+	client := &http.Client{Timeout: 5 *time.Second, Transport: NewTransport(&Config{Default: u.String()}, nil)}
+	if _, err := client.Get(ts.URL); err == nil{
+		t.Fatal("Expected an error with wrong SOCKS5 credentials")
+	}
+}
+
+func TestNoProxyGoesDirect(t *testing.T){
+	ts := startTestHTTPServer()
+	defer ts.Close()
+	p := NewHTTPProxy("", "")
+	defer p.Close()
+
+	_, body := get(t, NewTransport(&Config{Default: p.ProxyURL(), NoProxy: "127.0.0.1"}, nil), ts.URL)
+	if body != "Hello World"{
+		t.Fatalf("Expected Hello World, Got: %s", body)
+	}
+	if n := len(p.Visits()); n != 0{
+		t.Fatalf("Expected the proxy not to be used, Got: %d visits", n)
+	}
+}
@@ -0,0 +1,324 @@
+/*
+	Small stand-ins for a SOCKS5 proxy and an HTTP (forward + CONNECT) proxy,
+	in the spirit of httptest.Server: they listen on 127.0.0.1, record what
+	they were asked to do and can require credentials. They live in a
+	_test.go file, so they are only built with the tests of this package.
+
+*/
+
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+)
+
+// Visit is one request seen by a stand-in proxy.
+type Visit struct{
+	// Method is CONNECT, SOCKS5 or the method of a forwarded request.
+	Method	string
+	Target	string
+	Header	http.Header
+}
+
+type visitLog struct{
+	mu		sync.Mutex
+	visits	[]Visit
+}
+
+func (l *visitLog) add(v Visit){
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.visits = append(l.visits, v)
+}
+
+// Visits returns what the proxy was asked to do so far.
+func (l *visitLog) Visits() []Visit{
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Visit(nil), l.visits...)
+}
+
+// pipe copies in both directions until one side is done, then closes both.
+func pipe(a, b net.Conn){
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func(){
+		defer wg.Done()
+		io.Copy(a, b)
+		a.Close()
+	}()
+	go func(){
+		defer wg.Done()
+		io.Copy(b, a)
+		b.Close()
+	}()
+	wg.Wait()
+}
+
+// HTTPProxy is a forward proxy also supporting CONNECT.
+type HTTPProxy struct{
+	*httptest.Server
+	visitLog
+	// Username and Password, when set, are required in a Basic Proxy-Authorization header.
+	Username	string
+	Password	string
+}
+
+func NewHTTPProxy(username, password string) *HTTPProxy{
+	p := &HTTPProxy{Username: username, Password: password}
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serveHTTP))
+	return p
+}
+
+// ProxyURL returns the URL to put in a Config, with the credentials if any.
+func (p *HTTPProxy) ProxyURL() string{
+	return proxyURL("http", p.Listener.Addr().String(), p.Username, p.Password)
+}
+
+func proxyURL(scheme, addr, username, password string) string{
+	if username == ""{
+		return scheme + "://" + addr
+	}
+	return scheme + "://" + username + ":" + password + "@" + addr
+}
+
+func (p *HTTPProxy) authorized(r *http.Request) bool{
+	if p.Username == ""{
+		return true
+	}
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(p.Username+":"+p.Password))
+	return r.Header.Get("Proxy-Authorization") == expected
+}
+
+func (p *HTTPProxy) serveHTTP(w http.ResponseWriter, r *http.Request){
+	if r.Method == http.MethodConnect{
+		p.add(Visit{Method: r.Method, Target: r.Host, Header: r.Header.Clone()})
+	}else{
+		p.add(Visit{Method: r.Method, Target: r.URL.String(), Header: r.Header.Clone()})
+	}
+
+	if !p.authorized(r){
+		w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+		http.Error(w, "Proxy Authentication Required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	if r.Method == http.MethodConnect{
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil{
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil{
+			upstream.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		pipe(conn, upstream)
+		return
+	}
+
+	if !r.URL.IsAbs(){
+		http.Error(w, "Expected an absolute URL", http.StatusBadRequest)
+		return
+	}
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	//the Proxy-* headers are for us, not for the origin
+	for k := range out.Header{
+		if strings.HasPrefix(k, "Proxy-"){
+			out.Header.Del(k)
+		}
+	}
+	resp, err := http.DefaultTransport.RoundTrip(out)
+	if err != nil{
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header{
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// SOCKS5Proxy implements the CONNECT command of RFC 1928, with the
+// username/password authentication of RFC 1929 when Username is set.
+type SOCKS5Proxy struct{
+	visitLog
+	Listener	net.Listener
+	Username	string
+	Password	string
+	wg			sync.WaitGroup
+}
+
+func NewSOCKS5Proxy(username, password string) (*SOCKS5Proxy, error){
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil{
+		return nil, err
+	}
+	p := &SOCKS5Proxy{Listener: l, Username: username, Password: password}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+func (p *SOCKS5Proxy) ProxyURL() string{
+	return proxyURL("socks5", p.Listener.Addr().String(), p.Username, p.Password)
+}
+
+func (p *SOCKS5Proxy) Close() error{
+	err := p.Listener.Close()
+	p.wg.Wait()
+	return err
+}
+
+func (p *SOCKS5Proxy) serve(){
+	defer p.wg.Done()
+	for{
+		conn, err := p.Listener.Accept()
+		if err != nil{
+			return
+		}
+		go func(){
+			if err := p.handle(conn); err != nil{
+				conn.Close()
+			}
+		}()
+	}
+}
+
+const (
+	socksVersion		= 5
+	socksNoAuth			= 0
+	socksUserPass		= 2
+	socksNoAcceptable	= 0xff
+	socksConnect		= 1
+	socksIPv4			= 1
+	socksDomain			= 3
+	socksIPv6			= 4
+)
+
+func (p *SOCKS5Proxy) handle(conn net.Conn) error{
+	br := bufio.NewReader(conn)
+
+	// greeting: version, number of methods, methods
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(br, header); err != nil{
+		return err
+	}
+	if header[0] != socksVersion{
+		return errors.New("socks: unsupported version")
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(br, methods); err != nil{
+		return err
+	}
+	want := byte(socksNoAuth)
+	if p.Username != ""{
+		want = socksUserPass
+	}
+	found := false
+	for _, m := range methods{
+		found = found || m == want
+	}
+	if !found{
+		conn.Write([]byte{socksVersion, socksNoAcceptable})
+		return errors.New("socks: no acceptable method")
+	}
+	conn.Write([]byte{socksVersion, want})
+
+	if want == socksUserPass{
+		// version 1, username length, username, password length, password
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(br, b); err != nil{
+			return err
+		}
+		user := make([]byte, b[1])
+		if _, err := io.ReadFull(br, user); err != nil{
+			return err
+		}
+		if _, err := io.ReadFull(br, b[:1]); err != nil{
+			return err
+		}
+		pass := make([]byte, b[0])
+		if _, err := io.ReadFull(br, pass); err != nil{
+			return err
+		}
+		if string(user) != p.Username || string(pass) != p.Password{
+			conn.Write([]byte{1, 1})
+			return errors.New("socks: authentication failed")
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	// request: version, command, reserved, address type, address, port
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(br, req); err != nil{
+		return err
+	}
+	if req[1] != socksConnect{
+		conn.Write([]byte{socksVersion, 7, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+		return errors.New("socks: unsupported command")
+	}
+	var host string
+	switch req[3]{
+	case socksIPv4, socksIPv6:
+		size := net.IPv4len
+		if req[3] == socksIPv6{
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(br, ip); err != nil{
+			return err
+		}
+		host = net.IP(ip).String()
+	case socksDomain:
+		l, err := br.ReadByte()
+		if err != nil{
+			return err
+		}
+		name := make([]byte, l)
+		if _, err := io.ReadFull(br, name); err != nil{
+			return err
+		}
+		host = string(name)
+	default:
+		return errors.New("socks: unsupported address type")
+	}
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(br, portBytes); err != nil{
+		return err
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+	p.add(Visit{Method: "SOCKS5", Target: target})
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil{
+		// general failure
+		conn.Write([]byte{socksVersion, 1, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+		return err
+	}
+	conn.Write([]byte{socksVersion, 0, 0, socksIPv4, 0, 0, 0, 0, 0, 0})
+
+	// anything the client sent right after the request is already in br
+	if n := br.Buffered(); n > 0{
+		buffered, _ := br.Peek(n)
+		upstream.Write(buffered)
+	}
+	pipe(conn, upstream)
+	return nil
+}
@@ -0,0 +1,81 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves the client certificate and reloads it when the files change.
+// The files are checked at most once per interval, during a handshake.
+type certReloader struct{
+	certFile	string
+	keyFile		string
+	interval	time.Duration
+
+	mu			sync.Mutex
+	cert		*tls.Certificate
+	certMod		time.Time
+	keyMod		time.Time
+	lastCheck	time.Time
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration) (*certReloader, error){
+	if interval <= 0{
+		interval = 10 *time.Second
+	}
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := r.reload(); err != nil{
+		return nil, err
+	}
+	return r, nil
+}
+
+func modTime(path string) (time.Time, error){
+	fi, err := os.Stat(path)
+	if err != nil{
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// reload loads the key pair, the caller holds the lock (or is the constructor).
+func (r *certReloader) reload() error{
+	certMod, err := modTime(r.certFile)
+	if err != nil{
+		return err
+	}
+	keyMod, err := modTime(r.keyFile)
+	if err != nil{
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil{
+		return err
+	}
+	r.cert = &cert
+	r.certMod = certMod
+	r.keyMod = keyMod
+	r.lastCheck = time.Now()
+	return nil
+}
+
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error){
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastCheck) < r.interval{
+		return r.cert, nil
+	}
+	r.lastCheck = time.Now()
+
+	certMod, err1 := modTime(r.certFile)
+	keyMod, err2 := modTime(r.keyFile)
+	if err1 != nil || err2 != nil || (certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod)){
+		return r.cert, nil
+	}
+	// while a rotation is in progress the cert and the key may not match yet,
+	// on error reload leaves the previous pair in place and we try again later
+	r.reload()
+	return r.cert, nil
+}
@@ -0,0 +1,165 @@
+/*
+	createClientWithTimeout (connection-pooling) builds a Transport without
+	any TLS option, so it trusts the system roots only, offers no client
+	certificate and accepts whatever TLS version the server picks.
+
+	A Profile describes the TLS settings of a client in plain values, so it
+	can come from a config file:
+
+		CAFiles			PEM bundles of the CAs we trust (our internal CA...)
+		SystemRoots		trust the system roots as well
+		CertFile/KeyFile	client certificate for mutual TLS
+		MinVersion		"1.2" or "1.3"
+		CipherSuites	names as in crypto/tls, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+						(only for TLS 1.2, TLS 1.3 suites are not configurable)
+		ServerName		SNI and name to verify, when it differs from the URL host
+						(e.g. connecting by IP address)
+
+	The client certificate is reloaded when its files change on disk, so a
+	rotated certificate is picked up without restarting. Only new
+	connections use it: call CloseIdleConnections on the Transport to drop
+	the pooled ones right away.
+
+*/
+
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+type Profile struct{
+	CAFiles			[]string
+	SystemRoots		bool
+	CertFile		string
+	KeyFile			string
+	MinVersion		string
+	CipherSuites	[]string
+	ServerName		string
+	// ReloadCheckInterval is the minimum time between two checks of the certificate files, 10s if zero.
+	ReloadCheckInterval	time.Duration
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0":	tls.VersionTLS10,
+	"1.1":	tls.VersionTLS11,
+	"1.2":	tls.VersionTLS12,
+	"1.3":	tls.VersionTLS13,
+}
+
+func parseVersion(v string) (uint16, error){
+	if v == ""{
+		// the crypto/tls default for clients
+		return tls.VersionTLS12, nil
+	}
+	version, ok := tlsVersions[v]
+	if !ok{
+		return 0, fmt.Errorf("tls: unknown TLS version %q, expected one of 1.0, 1.1, 1.2, 1.3", v)
+	}
+	return version, nil
+}
+
+func parseCipherSuites(names []string) ([]uint16, error){
+	if len(names) == 0{
+		return nil, nil
+	}
+	known := map[string]uint16{}
+	for _, s := range tls.CipherSuites(){
+		known[s.Name] = s.ID
+	}
+	var ids []uint16
+	for _, n := range names{
+		id, ok := known[n]
+		if !ok{
+			return nil, fmt.Errorf("tls: unknown or insecure cipher suite %q", n)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func loadCAs(files []string, systemRoots bool) (*x509.CertPool, error){
+	if len(files) == 0{
+		// nil means the system roots
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if systemRoots{
+		sys, err := x509.SystemCertPool()
+		if err != nil{
+			return nil, err
+		}
+		pool = sys
+	}
+	for _, f := range files{
+		data, err := os.ReadFile(f)
+		if err != nil{
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data){
+			return nil, fmt.Errorf("tls: no certificate found in %s", f)
+		}
+	}
+	return pool, nil
+}
+
+// NewTLSConfig builds the *tls.Config of a profile.
+func NewTLSConfig(p Profile) (*tls.Config, error){
+	minVersion, err := parseVersion(p.MinVersion)
+	if err != nil{
+		return nil, err
+	}
+	suites, err := parseCipherSuites(p.CipherSuites)
+	if err != nil{
+		return nil, err
+	}
+	roots, err := loadCAs(p.CAFiles, p.SystemRoots)
+	if err != nil{
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		RootCAs:		roots,
+		MinVersion:		minVersion,
+		CipherSuites:	suites,
+		ServerName:		p.ServerName,
+	}
+
+	if p.CertFile != "" || p.KeyFile != ""{
+		if p.CertFile == "" || p.KeyFile == ""{
+			return nil, errors.New("tls: both CertFile and KeyFile are needed for a client certificate")
+		}
+		r, err := newCertReloader(p.CertFile, p.KeyFile, p.ReloadCheckInterval)
+		if err != nil{
+			return nil, err
+		}
+		cfg.GetClientCertificate = r.GetClientCertificate
+	}
+	return cfg, nil
+}
+
+// NewTransport returns a clone of http.DefaultTransport using the TLS settings of p.
+func NewTransport(p Profile) (*http.Transport, error){
+	cfg, err := NewTLSConfig(p)
+	if err != nil{
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return transport, nil
+}
+
+func createClientWithTimeout(d time.Duration, p Profile) (*http.Client, error){
+	transport, err := NewTransport(p)
+	if err != nil{
+		return nil, err
+	}
+	client := http.Client{Timeout: d, Transport: transport}
+	return &client, nil
+}
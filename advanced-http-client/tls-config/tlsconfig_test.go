@@ -0,0 +1,267 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct{
+	cert	*x509.Certificate
+	key		*ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA{
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil{
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:			big.NewInt(1),
+		Subject:				pkix.Name{CommonName: "Test Client CA"},
+		NotBefore:				time.Now().Add(-time.Hour),
+		NotAfter:				time.Now().Add(time.Hour),
+		IsCA:					true,
+		KeyUsage:				x509.KeyUsageCertSign,
+		BasicConstraintsValid:	true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil{
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// writeClientCert writes a client certificate signed by ca to certFile and keyFile.
+func (ca *testCA) writeClientCert(t *testing.T, commonName, certFile, keyFile string){
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil{
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:	big.NewInt(time.Now().UnixNano()),
+		Subject:		pkix.Name{CommonName: commonName},
+		NotBefore:		time.Now().Add(-time.Hour),
+		NotAfter:		time.Now().Add(time.Hour),
+		KeyUsage:		x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:	[]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil{
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil{
+		t.Fatal(err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte){
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil{
+		t.Fatal(err)
+	}
+}
+
+// writeServerCA writes the certificate of a httptest TLS server, so it can be trusted through CAFiles.
+func writeServerCA(t *testing.T, ts *httptest.Server) string{
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "server-ca.pem")
+	writePEM(t, path, "CERTIFICATE", ts.Certificate().Raw)
+	return path
+}
+
+func get(t *testing.T, client *http.Client, url string) string{
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestCustomCA(t *testing.T){
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Hello TLS")
+	}))
+	defer ts.Close()
+
+	// without the CA the test server certificate is rejected
+	client, err := createClientWithTimeout(5 *time.Second, Profile{})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ts.URL); err == nil{
+		t.Fatal("Expected an error without the server CA")
+	}
+
+	client, err = createClientWithTimeout(5 *time.Second, Profile{CAFiles: []string{writeServerCA(t, ts)}})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if body := get(t, client, ts.URL); body != "Hello TLS"{
+		t.Errorf("Expected Hello TLS, Got: %s", body)
+	}
+}
+
+func TestServerNameOverride(t *testing.T){
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.ServerName)
+	}))
+	defer ts.Close()
+	caFile := writeServerCA(t, ts)
+
+	// the httptest certificate is valid for example.com
+	client, err := createClientWithTimeout(5 *time.Second, Profile{CAFiles: []string{caFile}, ServerName: "example.com"})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if body := get(t, client, ts.URL); body != "example.com"{
+		t.Errorf("Expected the server to see SNI example.com, Got: %q", body)
+	}
+
+	client, err = createClientWithTimeout(5 *time.Second, Profile{CAFiles: []string{caFile}, ServerName: "other.example.org"})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ts.URL); err == nil{
+		t.Fatal("Expected a verification error for a name not in the certificate")
+	}
+}
+
+func TestMinVersionAndCipherSuites(t *testing.T){
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, tls.CipherSuiteName(r.TLS.CipherSuite))
+	}))
+	ts.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	ts.StartTLS()
+	defer ts.Close()
+	caFile := writeServerCA(t, ts)
+
+	client, err := createClientWithTimeout(5 *time.Second, Profile{CAFiles: []string{caFile}, MinVersion: "1.3"})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ts.URL); err == nil{
+		t.Fatal("Expected an error with a TLS 1.2 server and MinVersion 1.3")
+	}
+
+	suite := "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
+	client, err = createClientWithTimeout(5 *time.Second, Profile{CAFiles: []string{caFile}, MinVersion: "1.2", CipherSuites: []string{suite}})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if body := get(t, client, ts.URL); body != suite{
+		t.Errorf("Expected %s, Got: %s", suite, body)
+	}
+
+	if _, err := NewTLSConfig(Profile{MinVersion: "1.4"}); err == nil{
+		t.Error("Expected an error for an unknown TLS version")
+	}
+	if _, err := NewTLSConfig(Profile{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}); err == nil{
+		t.Error("Expected an error for an insecure cipher suite")
+	}
+}
+
+func startMutualTLSServer(t *testing.T, ca *testCA) *httptest.Server{
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	ts.StartTLS()
+	return ts
+}
+
+func TestMutualTLS(t *testing.T){
+	ca := newTestCA(t)
+	ts := startMutualTLSServer(t, ca)
+	defer ts.Close()
+	caFile := writeServerCA(t, ts)
+
+	client, err := createClientWithTimeout(5 *time.Second, Profile{CAFiles: []string{caFile}})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ts.URL); err == nil{
+		t.Fatal("Expected an error without a client certificate")
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	ca.writeClientCert(t, "client-a", certFile, keyFile)
+	client, err = createClientWithTimeout(5 *time.Second, Profile{CAFiles: []string{caFile}, CertFile: certFile, KeyFile: keyFile})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if body := get(t, client, ts.URL); body != "client-a"{
+		t.Errorf("Expected the server to see client-a, Got: %s", body)
+	}
+
+	if _, err := NewTLSConfig(Profile{CertFile: certFile}); err == nil{
+		t.Error("Expected an error with a certificate but no key")
+	}
+}
+
+func TestClientCertificateReload(t *testing.T){
+	ca := newTestCA(t)
+	ts := startMutualTLSServer(t, ca)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	ca.writeClientCert(t, "client-a", certFile, keyFile)
+
+	transport, err := NewTransport(Profile{
+		CAFiles:				[]string{writeServerCA(t, ts)},
+		CertFile:				certFile,
+		KeyFile:				keyFile,
+		ReloadCheckInterval:	time.Millisecond,
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	client := &http.Client{Timeout: 5 *time.Second, Transport: transport}
+	if body := get(t, client, ts.URL); body != "client-a"{
+		t.Fatalf("Expected client-a, Got: %s", body)
+	}
+
+	// rotate the certificate, the modification time may not change on a coarse file system
+	ca.writeClientCert(t, "client-b", certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	time.Sleep(5 *time.Millisecond)
+
+	// the pooled connection still uses the old certificate
+	if body := get(t, client, ts.URL); body != "client-a"{
+		t.Fatalf("Expected the idle connection to be reused with client-a, Got: %s", body)
+	}
+	transport.CloseIdleConnections()
+	if body := get(t, client, ts.URL); body != "client-b"{
+		t.Errorf("Expected the rotated certificate client-b, Got: %s", body)
+	}
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// SpanEvent is a point in time inside a span, e.g. the DNS lookup finished.
+type SpanEvent struct{
+	Name		string				`json:"name"`
+	Time		time.Time			`json:"time"`
+	Attributes	map[string]string	`json:"attributes,omitempty"`
+}
+
+// Span is one finished client request.
+type Span struct{
+	Name			string				`json:"name"`
+	Kind			string				`json:"kind"`
+	TraceID			string				`json:"trace_id"`
+	SpanID			string				`json:"span_id"`
+	ParentSpanID	string				`json:"parent_span_id,omitempty"`
+	TraceState		string				`json:"trace_state,omitempty"`
+	Start			time.Time			`json:"start"`
+	End				time.Time			`json:"end"`
+	Attributes		map[string]string	`json:"attributes,omitempty"`
+	Events			[]SpanEvent			`json:"events,omitempty"`
+	// Error is empty when the request succeeded.
+	Error			string				`json:"error,omitempty"`
+}
+
+func (s Span) Duration() time.Duration{
+	return s.End.Sub(s.Start)
+}
+
+// Exporter receives every finished span. ExportSpan is called concurrently
+// from all the goroutines using the client, so implementations must be safe for concurrent use.
+type Exporter interface{
+	ExportSpan(s Span) error
+}
+
+// InMemoryExporter keeps the spans in a slice, useful in tests.
+type InMemoryExporter struct{
+	mu		sync.Mutex
+	spans	[]Span
+}
+
+func (e *InMemoryExporter) ExportSpan(s Span) error{
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+	return nil
+}
+
+// Spans returns a copy of the spans exported so far.
+func (e *InMemoryExporter) Spans() []Span{
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Span(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset(){
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// JSONLinesExporter writes one JSON object per span and per line.
+type JSONLinesExporter struct{
+	mu		sync.Mutex
+	w		io.Writer
+	closer	io.Closer
+}
+
+func NewJSONLinesExporter(w io.Writer) *JSONLinesExporter{
+	return &JSONLinesExporter{w: w}
+}
+
+// NewJSONLinesFileExporter appends spans to the file at path, creating it if needed.
+func NewJSONLinesFileExporter(path string) (*JSONLinesExporter, error){
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil{
+		return nil, err
+	}
+	return &JSONLinesExporter{w: f, closer: f}, nil
+}
+
+func (e *JSONLinesExporter) ExportSpan(s Span) error{
+	data, err := json.Marshal(s)
+	if err != nil{
+		return err
+	}
+	data = append(data, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(data)
+	return err
+}
+
+// Close closes the underlying file, if the exporter opened one.
+func (e *JSONLinesExporter) Close() error{
+	if e.closer == nil{
+		return nil
+	}
+	return e.closer.Close()
+}
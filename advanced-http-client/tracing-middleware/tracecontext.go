@@ -0,0 +1,128 @@
+/*
+	W3C Trace Context (https://www.w3.org/TR/trace-context/) defines two
+	headers that carry a trace from one service to the next:
+
+		traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+		             |  |                                |                |
+		        version  trace-id (16 bytes)             parent-id (8)    flags
+
+		tracestate: vendor specific key=value pairs, passed along untouched.
+
+	Every request we send gets a new span-id, the trace-id is kept from the
+	parent (if there is one in the request context) so that all the spans of
+	one logical operation end up in the same trace.
+
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string{
+	return hex.EncodeToString(t[:])
+}
+
+func (s SpanID) String() string{
+	return hex.EncodeToString(s[:])
+}
+
+func (t TraceID) IsValid() bool{
+	return t != TraceID{}
+}
+
+func (s SpanID) IsValid() bool{
+	return s != SpanID{}
+}
+
+// The only flag defined by the spec: the caller recorded this trace.
+const FlagSampled byte = 0x01
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct{
+	TraceID		TraceID
+	SpanID		SpanID
+	Flags		byte
+	TraceState	string
+}
+
+func (sc SpanContext) IsValid() bool{
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent renders the traceparent header value.
+func (sc SpanContext) Traceparent() string{
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+var errInvalidTraceparent = errors.New("invalid traceparent header")
+
+// ParseTraceparent parses a traceparent header value.
+// Versions other than 00 are accepted as long as the first four fields are well formed, as the spec asks.
+func ParseTraceparent(v string) (SpanContext, error){
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4{
+		return sc, errInvalidTraceparent
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4){
+		return sc, errInvalidTraceparent
+	}
+	if len(traceID) != 32 || len(spanID) != 16 || len(flags) != 2{
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(traceID)); err != nil{
+		return sc, errInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(spanID)); err != nil{
+		return sc, errInvalidTraceparent
+	}
+	f, err := hex.DecodeString(flags)
+	if err != nil{
+		return sc, errInvalidTraceparent
+	}
+	sc.Flags = f[0]
+	if !sc.IsValid(){
+		return sc, errInvalidTraceparent
+	}
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc as the parent of spans started from it.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context{
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context stored in ctx, if any.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool){
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+func newTraceID() TraceID{
+	var t TraceID
+	for !t.IsValid(){
+		rand.Read(t[:])
+	}
+	return t
+}
+
+func newSpanID() SpanID{
+	var s SpanID
+	for !s.IsValid(){
+		rand.Read(s[:])
+	}
+	return s
+}
@@ -0,0 +1,241 @@
+/*
+	TracingTransport is a RoundTripper middleware (see header-middleware and
+	logging-middleware) that records one client span per request.
+
+	For every request it:
+		1. picks the parent span from the request context (ContextWithSpanContext),
+		   or starts a new trace when there is none,
+		2. injects the traceparent and tracestate headers into a copy of the request,
+		3. attaches an httptrace.ClientTrace (like connection-pooling does) and
+		   records every phase - DNS, connect, TLS, got conn, first byte - as a span event,
+		4. ends the span when the response body is closed (or fully read) and
+		   hands it to the Exporter.
+
+	Only sampled traces are exported; a trace we start ourselves is always sampled,
+	a continued trace keeps the decision of its parent.
+
+*/
+
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type TracingTransport struct{
+	// Transport is the RoundTripper that actually sends the request, http.DefaultTransport if nil.
+	Transport	http.RoundTripper
+	Exporter	Exporter
+	// OnExportError is called when the exporter fails, errors are dropped if nil.
+	OnExportError	func(error)
+}
+
+// spanRecorder collects the events of one span, the httptrace hooks may be called from different goroutines.
+type spanRecorder struct{
+	mu		sync.Mutex
+	span	Span
+	sampled	bool
+	done	bool
+	t		*TracingTransport
+}
+
+func (s *spanRecorder) event(name string, attrs map[string]string){
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done{
+		return
+	}
+	s.span.Events = append(s.span.Events, SpanEvent{Name: name, Time: time.Now(), Attributes: attrs})
+}
+
+func (s *spanRecorder) setAttr(k, v string){
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.span.Attributes[k] = v
+}
+
+func (s *spanRecorder) end(err error){
+	s.mu.Lock()
+	if s.done{
+		s.mu.Unlock()
+		return
+	}
+	s.done = true
+	s.span.End = time.Now()
+	if err != nil{
+		s.span.Error = err.Error()
+	}
+	span := s.span
+	s.mu.Unlock()
+
+	if !s.sampled || s.t.Exporter == nil{
+		return
+	}
+	if err := s.t.Exporter.ExportSpan(span); err != nil && s.t.OnExportError != nil{
+		s.t.OnExportError(err)
+	}
+}
+
+func (s *spanRecorder) clientTrace() *httptrace.ClientTrace{
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			s.event("get_conn", map[string]string{"host_port": hostPort})
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			s.event("dns_start", map[string]string{"host": info.Host})
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			attrs := map[string]string{}
+			for i, a := range info.Addrs{
+				attrs["addr."+strconv.Itoa(i)] = a.String()
+			}
+			if info.Err != nil{
+				attrs["error"] = info.Err.Error()
+			}
+			s.event("dns_done", attrs)
+		},
+		ConnectStart: func(network, addr string) {
+			s.event("connect_start", map[string]string{"network": network, "addr": addr})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			attrs := map[string]string{"network": network, "addr": addr}
+			if err != nil{
+				attrs["error"] = err.Error()
+			}
+			s.event("connect_done", attrs)
+		},
+		TLSHandshakeStart: func() {
+			s.event("tls_handshake_start", nil)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			attrs := map[string]string{
+				"version":	tls.VersionName(state.Version),
+				"cipher":	tls.CipherSuiteName(state.CipherSuite),
+				"alpn":		state.NegotiatedProtocol,
+			}
+			if err != nil{
+				attrs["error"] = err.Error()
+			}
+			s.event("tls_handshake_done", attrs)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			attrs := map[string]string{
+				"reused":	strconv.FormatBool(info.Reused),
+				"was_idle":	strconv.FormatBool(info.WasIdle),
+			}
+			if info.Conn != nil{
+				attrs["remote_addr"] = info.Conn.RemoteAddr().String()
+			}
+			if info.WasIdle{
+				attrs["idle_time"] = info.IdleTime.String()
+			}
+			s.event("got_conn", attrs)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			attrs := map[string]string{}
+			if info.Err != nil{
+				attrs["error"] = info.Err.Error()
+			}
+			s.event("wrote_request", attrs)
+		},
+		GotFirstResponseByte: func() {
+			s.event("got_first_response_byte", nil)
+		},
+	}
+}
+
+func (t *TracingTransport) RoundTrip(r *http.Request)(*http.Response, error){
+	transport := t.Transport
+	if transport == nil{
+		transport = http.DefaultTransport
+	}
+
+	sc := SpanContext{SpanID: newSpanID(), Flags: FlagSampled}
+	rec := &spanRecorder{t: t}
+	if parent, ok := SpanContextFromContext(r.Context()); ok{
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+		rec.span.ParentSpanID = parent.SpanID.String()
+	}else{
+		sc.TraceID = newTraceID()
+	}
+	rec.sampled = sc.Flags&FlagSampled != 0
+
+	rec.span.Name = "HTTP " + r.Method
+	rec.span.Kind = "client"
+	rec.span.TraceID = sc.TraceID.String()
+	rec.span.SpanID = sc.SpanID.String()
+	rec.span.TraceState = sc.TraceState
+	rec.span.Start = time.Now()
+	rec.span.Attributes = map[string]string{
+		"http.method":	r.Method,
+		"http.url":		r.URL.Redacted(),
+		"net.peer.name":	r.URL.Hostname(),
+	}
+
+	// httptrace.WithClientTrace keeps any trace already attached to the context, both get called.
+	ctx := httptrace.WithClientTrace(ContextWithSpanContext(r.Context(), sc), rec.clientTrace())
+	reqCopy := r.Clone(ctx)
+	reqCopy.Header.Set("traceparent", sc.Traceparent())
+	if sc.TraceState != ""{
+		reqCopy.Header.Set("tracestate", sc.TraceState)
+	}else{
+		reqCopy.Header.Del("tracestate")
+	}
+
+	resp, err := transport.RoundTrip(reqCopy)
+	if err != nil{
+		rec.end(err)
+		return resp, err
+	}
+
+	rec.setAttr("http.status_code", strconv.Itoa(resp.StatusCode))
+	rec.setAttr("http.flavor", resp.Proto)
+	var statusErr error
+	if resp.StatusCode >= http.StatusInternalServerError{
+		statusErr = fmt.Errorf("server responded with %s", resp.Status)
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, rec: rec, statusErr: statusErr}
+	return resp, nil
+}
+
+// spanBody ends the span once the caller is done with the response.
+type spanBody struct{
+	io.ReadCloser
+	rec			*spanRecorder
+	statusErr	error
+}
+
+func (b *spanBody) Read(p []byte) (int, error){
+	n, err := b.ReadCloser.Read(p)
+	switch{
+	case err == io.EOF:
+		b.rec.end(b.statusErr)
+	case err != nil:
+		b.rec.end(err)
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error{
+	err := b.ReadCloser.Close()
+	b.rec.end(b.statusErr)
+	return err
+}
+
+// createTracingClient returns a client exporting a span for every request it makes.
+func createTracingClient(d time.Duration, e Exporter) *http.Client{
+	client := http.Client{
+		Timeout:	d,
+		Transport:	&TracingTransport{Exporter: e},
+	}
+	return &client
+}
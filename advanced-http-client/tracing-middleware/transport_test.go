@@ -0,0 +1,148 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The test server echoes the trace headers it received back in the response.
+func startTraceEchoServer() *httptest.Server{
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Got-Traceparent", r.Header.Get("traceparent"))
+		w.Header().Set("X-Got-Tracestate", r.Header.Get("tracestate"))
+		fmt.Fprint(w, "Hello World")
+	}))
+	return ts
+}
+
+func doGet(t *testing.T, client *http.Client, ctx context.Context, url string) *http.Response{
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil{
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestTracingTransportNewTrace(t *testing.T){
+	ts := startTraceEchoServer()
+	defer ts.Close()
+
+	exporter := &InMemoryExporter{}
+	client := createTracingClient(5 *time.Second, exporter)
+
+	resp := doGet(t, client, context.Background(), ts.URL)
+
+	spans := exporter.Spans()
+	if len(spans) != 1{
+		t.Fatalf("Expected 1 span, Got: %d", len(spans))
+	}
+	s := spans[0]
+	expected := fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID)
+	if got := resp.Header.Get("X-Got-Traceparent"); got != expected{
+		t.Fatalf("Expected traceparent: %s, Got: %s", expected, got)
+	}
+	if s.ParentSpanID != ""{
+		t.Errorf("Expected a root span, Got parent: %s", s.ParentSpanID)
+	}
+	if s.Attributes["http.status_code"] != "200"{
+		t.Errorf("Expected status code attribute 200, Got: %s", s.Attributes["http.status_code"])
+	}
+
+	names := map[string]bool{}
+	for _, e := range s.Events{
+		names[e.Name] = true
+	}
+	for _, n := range []string{"get_conn", "connect_done", "got_conn", "wrote_request", "got_first_response_byte"}{
+		if !names[n]{
+			t.Errorf("Expected span event %s, Got: %+v", n, s.Events)
+		}
+	}
+}
+
+func TestTracingTransportContinuesParent(t *testing.T){
+	ts := startTraceEchoServer()
+	defer ts.Close()
+
+	parent, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil{
+		t.Fatal(err)
+	}
+	parent.TraceState = "vendor=abc"
+
+	exporter := &InMemoryExporter{}
+	client := createTracingClient(5 *time.Second, exporter)
+	resp := doGet(t, client, ContextWithSpanContext(context.Background(), parent), ts.URL)
+
+	s := exporter.Spans()[0]
+	if s.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || s.ParentSpanID != "00f067aa0ba902b7"{
+		t.Fatalf("Expected span to continue the parent trace, Got trace: %s, parent: %s", s.TraceID, s.ParentSpanID)
+	}
+	if got := resp.Header.Get("X-Got-Tracestate"); got != "vendor=abc"{
+		t.Errorf("Expected tracestate: vendor=abc, Got: %s", got)
+	}
+}
+
+func TestParseTraceparentInvalid(t *testing.T){
+	for _, v := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}{
+		if _, err := ParseTraceparent(v); err == nil{
+			t.Errorf("Expected error for traceparent %q, Got nil", v)
+		}
+	}
+}
+
+func TestJSONLinesFileExporter(t *testing.T){
+	ts := startTraceEchoServer()
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	exporter, err := NewJSONLinesFileExporter(path)
+	if err != nil{
+		t.Fatal(err)
+	}
+	client := createTracingClient(5 *time.Second, exporter)
+	doGet(t, client, context.Background(), ts.URL)
+	doGet(t, client, context.Background(), ts.URL)
+	exporter.Close()
+
+	f, err := os.Open(path)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan(){
+		s := Span{}
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil{
+			t.Fatal(err)
+		}
+		lines++
+	}
+	if lines != 2{
+		t.Fatalf("Expected 2 spans in the file, Got: %d", lines)
+	}
+}
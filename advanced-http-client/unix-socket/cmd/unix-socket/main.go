@@ -0,0 +1,63 @@
+/*
+	Fetch a resource from a server listening on a Unix socket:
+
+		$ go run ./cmd/unix-socket unix:///var/run/docker.sock /version
+		$ go run ./cmd/unix-socket -sockets registry=/run/registry.sock http://registry/api/packages
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	unixsocket "github.com/Praveen005/Go-http-client/tree/main/advanced-http-client/unix-socket"
+)
+
+func FetchRemoteResource(client *http.Client, url string)([]byte, error){
+	r, err := client.Get(url)
+	if err != nil{
+		return nil, err
+	}
+	defer r.Body.Close()
+	return io.ReadAll(r.Body)
+}
+
+func main(){
+	socketMap := flag.String("sockets", "", "host=/path/to.sock pairs, comma separated")
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2{
+		fmt.Fprintln(os.Stdout, "Usage: unix-socket [-sockets host=path,...] unix:///path/to.sock|URL [path]")
+		os.Exit(1)
+	}
+
+	base, sockets, err := unixsocket.ParseTarget(flag.Arg(0))
+	if err != nil{
+		fmt.Fprintf(os.Stdout, "%v\n", err)
+		os.Exit(1)
+	}
+	extra, err := unixsocket.ParseSocketMap(*socketMap)
+	if err != nil{
+		fmt.Fprintf(os.Stdout, "%v\n", err)
+		os.Exit(1)
+	}
+	if sockets == nil{
+		sockets = map[string]string{}
+	}
+	for host, path := range extra{
+		sockets[host] = path
+	}
+
+	client := unixsocket.CreateHTTPClientWithSockets(15 *time.Second, sockets)
+	data, err := FetchRemoteResource(client, base+flag.Arg(1))
+	if err != nil{
+		fmt.Fprintf(os.Stdout, "%#v", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", data)
+}
@@ -0,0 +1,114 @@
+/*
+	Local daemons (container runtime, sidecars...) often serve HTTP on a
+	Unix domain socket instead of a TCP port. HTTP does not care what the
+	connection is made of: the Transport calls DialContext with "tcp" and
+	host:port, and we are free to return a connection to a socket instead.
+
+	Sockets maps a host name to a socket path. Requests to that host (any
+	port, http or https) are dialed on the socket, the others go through
+	the usual TCP dialer. The URL stays an ordinary http:// URL, so the code
+	building requests (FetchRemoteResource, the registry helpers) does not
+	change, only the client it is given.
+	The proxy of base (HTTP_PROXY and friends for the default transport)
+	still applies to the other hosts, never to the hosts of sockets.
+
+	A target can also be written unix:///path/to.sock: ParseTarget turns it
+	into the base URL http://localhost plus the mapping localhost -> socket.
+
+	cmd/unix-socket is a small fetch command built on this package.
+
+*/
+
+package unixsocket
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NewTransport clones base (http.DefaultTransport if nil) and dials the hosts of sockets on their Unix socket.
+func NewTransport(base *http.Transport, sockets map[string]string) *http.Transport{
+	if base == nil{
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	transport := base.Clone()
+	next := transport.DialContext
+	if next == nil{
+		next = (&net.Dialer{}).DialContext
+	}
+	paths := map[string]string{}
+	for host, path := range sockets{
+		paths[strings.ToLower(host)] = path
+	}
+	//a proxy would dial its own address, not the socket: the hosts of sockets never go through it
+	if proxy := transport.Proxy; proxy != nil{
+		transport.Proxy = func(r *http.Request) (*url.URL, error){
+			if _, ok := paths[strings.ToLower(r.URL.Hostname())]; ok{
+				return nil, nil
+			}
+			return proxy(r)
+		}
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error){
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil{
+			host = addr
+		}
+		if path, ok := paths[strings.ToLower(host)]; ok{
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		return next(ctx, network, addr)
+	}
+	return transport
+}
+
+// unixHost is the host of the base URL of a unix:// target, it is what the server sees in the Host header.
+const unixHost = "localhost"
+
+// ParseTarget returns the base URL to build the request URLs from and the sockets to dial.
+// http:// and https:// targets are returned as they are, with no socket.
+func ParseTarget(target string) (string, map[string]string, error){
+	u, err := url.Parse(target)
+	if err != nil{
+		return "", nil, err
+	}
+	switch u.Scheme{
+	case "http", "https":
+		return strings.TrimSuffix(target, "/"), nil, nil
+	case "unix":
+		if u.Host != "" || u.Path == ""{
+			return "", nil, fmt.Errorf("unix socket target should be unix:///path/to.sock, Got: %s", target)
+		}
+		return "http://" + unixHost, map[string]string{unixHost: u.Path}, nil
+	}
+	return "", nil, fmt.Errorf("unsupported target scheme %q", u.Scheme)
+}
+
+// ParseSocketMap parses "host=/path/a.sock,other=/path/b.sock".
+func ParseSocketMap(s string) (map[string]string, error){
+	sockets := map[string]string{}
+	for _, entry := range strings.Split(s, ","){
+		entry = strings.TrimSpace(entry)
+		if entry == ""{
+			continue
+		}
+		host, path, ok := strings.Cut(entry, "=")
+		if !ok || host == "" || path == ""{
+			return nil, fmt.Errorf("invalid socket mapping %q, expected host=/path/to.sock", entry)
+		}
+		sockets[host] = path
+	}
+	return sockets, nil
+}
+
+// CreateHTTPClientWithSockets returns a client dialing the hosts of sockets on their Unix socket.
+func CreateHTTPClientWithSockets(d time.Duration, sockets map[string]string) *http.Client{
+	client := http.Client{Timeout: d, Transport: NewTransport(nil, sockets)}
+	return &client
+}
@@ -0,0 +1,133 @@
+package unixsocket
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func fetch(client *http.Client, url string)([]byte, error){
+	r, err := client.Get(url)
+	if err != nil{
+		return nil, err
+	}
+	defer r.Body.Close()
+	return io.ReadAll(r.Body)
+}
+
+// startTestSocketServer serves a httptest handler on a Unix socket in a temp directory.
+func startTestSocketServer(t *testing.T, name string) (*httptest.Server, string){
+	t.Helper()
+	// socket paths are limited to about 100 bytes, t.TempDir() can be longer
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, name+".sock")
+	l, err := net.Listen("unix", path)
+	if err != nil{
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s %s", name, r.Host, r.URL.Path)
+	}))
+	ts.Listener = l
+	ts.Start()
+	return ts, path
+}
+
+func TestUnixTarget(t *testing.T){
+	ts, path := startTestSocketServer(t, "daemon")
+	defer ts.Close()
+
+	base, sockets, err := ParseTarget("unix://" + path)
+	if err != nil{
+		t.Fatal(err)
+	}
+	client := CreateHTTPClientWithSockets(5 *time.Second, sockets)
+	data, err := fetch(client, base+"/v1/info")
+	if err != nil{
+		t.Fatal(err)
+	}
+	if string(data) != "daemon localhost /v1/info"{
+		t.Errorf("Expected daemon localhost /v1/info, Got: %s", data)
+	}
+}
+
+func TestSocketMapping(t *testing.T){
+	registry, registryPath := startTestSocketServer(t, "registry")
+	defer registry.Close()
+	sidecar, sidecarPath := startTestSocketServer(t, "sidecar")
+	defer sidecar.Close()
+	tcp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "tcp")
+	}))
+	defer tcp.Close()
+
+	sockets, err := ParseSocketMap("registry=" + registryPath + ", Sidecar.Local=" + sidecarPath)
+	if err != nil{
+		t.Fatal(err)
+	}
+	client := CreateHTTPClientWithSockets(5 *time.Second, sockets)
+	for url, expected := range map[string]string{
+		"http://registry/api/packages":		"registry registry /api/packages",
+		"http://sidecar.local:8080/health":	"sidecar sidecar.local:8080 /health",
+		tcp.URL:							"tcp",
+	}{
+		data, err := fetch(client, url)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if string(data) != expected{
+			t.Errorf("Expected %q for %s, Got: %q", expected, url, data)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T){
+	for _, target := range []string{"unix://host/path.sock", "unix://", "ftp://example.com"}{
+		if _, _, err := ParseTarget(target); err == nil{
+			t.Errorf("Expected an error for %s", target)
+		}
+	}
+	if _, err := ParseSocketMap("registry"); err == nil{
+		t.Error("Expected an error for a mapping without path")
+	}
+}
+
+func TestSocketHostsBypassProxy(t *testing.T){
+	registry, registryPath := startTestSocketServer(t, "registry")
+	defer registry.Close()
+	// the proxy answers every request itself
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "proxy")
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	base := &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+	client := &http.Client{Timeout: 5 *time.Second, Transport: NewTransport(base, map[string]string{"registry": registryPath})}
+	for url, expected := range map[string]string{
+		"http://registry/api/packages":	"registry registry /api/packages",
+		"http://example.com/":			"proxy",
+	}{
+		data, err := fetch(client, url)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if string(data) != expected{
+			t.Errorf("Expected %q for %s, Got: %q", expected, url, data)
+		}
+	}
+}
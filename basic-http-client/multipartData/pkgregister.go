@@ -1,23 +1,41 @@
 package pkgregisterdata
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
+	"path/filepath"
+
+	"github.com/Praveen005/Go-http-client/tree/main/basic-http-client/registry"
 )
 
 func registerPackageData(url string, data pkgData)(packageRegisterResult, error){
 	//create an instance of response data
 	p := packageRegisterResult{}
-	payload, contentType, err := createMultipartMessage(data)
+	if data.Filename == "" && data.Path != ""{
+		data.Filename = filepath.Base(data.Path)
+	}
+	//check the payload before building the message, to report every problem at once
+	if err := validatePackageData(data); err != nil{
+		return p, err
+	}
+	//the message is streamed to the server as it is written, see the registry package
+	req, done, err := registry.NewUploadRequest(context.Background(), url, data.artifact())
 	//handle error
 	if err != nil{
 		return p, err
 	}
-	reader := bytes.NewReader(payload)
 
-	resp, err := http.Post(url, contentType, reader)
+	resp, err := http.DefaultClient.Do(req)
+	//stop the goroutines of the bodies the transport did not read to the end, and get the error of the file
+	if werr := done(); werr != nil{
+		//the error of the file (or its size) explains the failure better than the transport
+		if err == nil{
+			resp.Body.Close()
+		}
+		return p, werr
+	}
 	//handle error
 	if err != nil{
 		return p, err
@@ -30,6 +48,11 @@ func registerPackageData(url string, data pkgData)(packageRegisterResult, error)
 		return p, err
 	}
 
+	if resp.StatusCode != http.StatusOK{
+		//decode the problem details (or the error message) sent by the server
+		return p, newProblemError(resp, respData)
+	}
+
 	err= json.Unmarshal(respData, &p)
 	return p, err
 }
@@ -0,0 +1,30 @@
+/*
+	registerPackageData used to ignore the status and unmarshal any body
+	as a result, so a failed upload looked like a package with no ID.
+
+	The body of an error response is decoded by the registry package, as
+	for registry.Client: a 413 for an artifact too large usually carries
+	the limit as an extension member, a 503 from a proxy is plain text.
+
+		var problem *ProblemError
+		if errors.As(err, &problem) && problem.Status == http.StatusRequestEntityTooLarge{
+			limit, _ := problem.Extensions["limit"].(float64)
+			...
+		}
+
+*/
+
+package pkgregisterdata
+
+import (
+	"net/http"
+
+	"github.com/Praveen005/Go-http-client/tree/main/basic-http-client/registry"
+)
+
+type ProblemError = registry.ProblemError
+
+// newProblemError decodes the body of an error response.
+func newProblemError(resp *http.Response, body []byte) *ProblemError{
+	return registry.DecodeProblem(resp, body)
+}
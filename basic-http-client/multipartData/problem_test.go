@@ -0,0 +1,47 @@
+package pkgregisterdata
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegisterPackageDataProblem(t *testing.T){
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		fmt.Fprint(w, `{"title": "Artifact too large", "detail": "the limit is 10 MiB", "limit": 10485760}`)
+	}))
+	defer ts.Close()
+
+	p := pkgData{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Bytes: strings.NewReader("data")}
+	_, err := registerPackageData(ts.URL, p)
+	var problem *ProblemError
+	if !errors.As(err, &problem){
+		t.Fatalf("Expected a *ProblemError, Got: %T %v", err, err)
+	}
+	if problem.Status != http.StatusRequestEntityTooLarge || problem.Title != "Artifact too large" || problem.Detail != "the limit is 10 MiB"{
+		t.Errorf("Expected status 413 with its title and detail, Got: %+v", problem)
+	}
+	if problem.Extensions["limit"] != float64(10485760){
+		t.Errorf("Expected the extension limit, Got: %v", problem.Extensions)
+	}
+}
+
+func TestRegisterPackageDataErrorStatus(t *testing.T){
+	// before, a plain text error was unmarshalled as a result
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "storage unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	p := pkgData{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Bytes: strings.NewReader("data")}
+	_, err := registerPackageData(ts.URL, p)
+	var problem *ProblemError
+	if !errors.As(err, &problem) || problem.Status != http.StatusServiceUnavailable || problem.Detail != "storage unavailable"{
+		t.Fatalf("Expected a 503 *ProblemError, Got: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+/*
+	An upload is refused by the registry for its form fields or for its
+	file part, and the file part is the expensive one: finding out from a
+	"413" or "400" that the file was a 200 MiB .exe means sending the 200
+	MiB first. So validatePackageData looks at the whole upload before the
+	request is made and reports every problem at once, with the rules of
+	the registry package (registry.ValidateArtifact): the name and version
+	form fields, the filename of the file part and the artifact, pkgData.Path
+	or pkgData.Bytes, which may be neither empty nor larger than
+	registry.MaxArtifactSize.
+
+	A reader that cannot tell its size is copied to a temporary file before
+	the request is made, see registry.NewUploadRequest.
+
+*/
+
+package pkgregisterdata
+
+import (
+	"github.com/Praveen005/Go-http-client/tree/main/basic-http-client/registry"
+)
+
+// FieldError is one problem with the upload.
+type FieldError = registry.FieldError
+
+// ValidationErrors lists every problem of an upload, in the order of the multipart message.
+type ValidationErrors = registry.ValidationErrors
+
+// artifact is the upload of data for the registry package.
+func (data pkgData) artifact() registry.Artifact{
+	return registry.Artifact{Name: data.Name, Version: data.Version, Filename: data.Filename, Bytes: data.Bytes, Path: data.Path}
+}
+
+// validatePackageData returns a ValidationErrors with every problem of the upload of data, or nil.
+func validatePackageData(data pkgData) error{
+	return registry.ValidateArtifact(data.artifact())
+}
@@ -0,0 +1,33 @@
+package pkgregisterdata
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Praveen005/Go-http-client/tree/main/basic-http-client/registry"
+)
+
+func TestRegisterOversizedStreamNoRequest(t *testing.T){
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		packageRegHandler(w, r)
+	}))
+	defer ts.Close()
+
+	// a reader without Len or Stat, only checked while building the message
+	big := io.MultiReader(strings.NewReader(strings.Repeat("a", registry.MaxArtifactSize)), strings.NewReader("a"))
+	p := pkgData{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Bytes: big}
+	_, err := registerPackageData(ts.URL, p)
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) || verrs[0].Field != "bytes"{
+		t.Fatalf("Expected a validation error for bytes, Got: %v", err)
+	}
+	if requests != 0{
+		t.Errorf("Expected no request to be sent, Got: %d", requests)
+	}
+}
@@ -1,3 +1,7 @@
 module github.com/Praveen005/Go-http-client/tree/main/basic-http-client/pkgRegister
 
 go 1.21.2
+
+require github.com/Praveen005/Go-http-client/tree/main/basic-http-client/registry v0.0.0
+
+replace github.com/Praveen005/Go-http-client/tree/main/basic-http-client/registry => ../registry
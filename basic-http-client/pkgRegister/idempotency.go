@@ -0,0 +1,333 @@
+/*
+	A POST is not idempotent: if the response is lost after the server
+	registered the package (a time-out, a reset connection), retrying it
+	registers the package a second time.
+
+	With an Idempotency-Key header (draft-ietf-httpapi-idempotency-key-header)
+	the server stores the response of the first request with a key, and
+	answers a request with the same key by replaying that response,
+	marked with Idempotent-Replayed: true, instead of processing it again:
+
+		POST /packages	Idempotency-Key: 9b2f...	-> time-out, but registered
+		POST /packages	Idempotency-Key: 9b2f...	-> 200, Idempotent-Replayed: true
+
+	So the key has to identify the logical registration, not the request:
+	it is generated once, before the first attempt, and reused by every
+	retry. It is kept in a keyStore while the registration is in flight,
+	in memory, or in the file named by PKGREGISTER_KEY_FILE so that the
+	run after a crash still sends the same key. Once the call returns the
+	key is dropped, whatever the outcome: the server stores failures too
+	(a 5xx, the last time-out), and a key kept after them would only
+	replay the stored failure to the next registration of the package.
+
+	The server answers 409 Conflict with a Retry-After header while a
+	request with the same key is being processed: the outcome of the
+	registration is not known yet, the request is sent again after the
+	wait, up to InProgressRetries times. The wait is capped by
+	MaxRetryAfter, a Retry-After of an hour must not block the caller for
+	hours, and like the backoff between retries it ends early when the
+	context is done. Any other 409 (the package is already registered)
+	and the 422 sent when the key was used with another payload are final.
+
+*/
+
+package pkgregister
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type registerOptions struct{
+	Client		*http.Client
+	// Retries is the number of attempts after the first one.
+	Retries		int
+	// Backoff is the wait before the first retry, doubled for each next one.
+	Backoff		time.Duration
+	// InProgressRetries is the number of times a request is sent again while the server
+	// is still processing the same key, they are not counted in Retries.
+	InProgressRetries	int
+	// MaxRetryAfter caps the wait asked by Retry-After, maxRetryAfter when zero.
+	MaxRetryAfter		time.Duration
+	// Keys keeps the keys of the registrations in flight.
+	Keys		keyStore
+}
+
+const maxRetryAfter = 30 *time.Second
+
+// defaultRegisterOptions returns the options of registerPackageData, with the key store named by PKGREGISTER_KEY_FILE.
+func defaultRegisterOptions() registerOptions{
+	return registerOptions{
+		Client:				&http.Client{Timeout: 30 *time.Second},
+		Retries:			3,
+		Backoff:			200 *time.Millisecond,
+		InProgressRetries:	5,
+		Keys:				defaultKeyStore(),
+	}
+}
+
+// keyFileEnv names the file keeping the keys across runs, the keys are only kept in memory without it.
+const keyFileEnv = "PKGREGISTER_KEY_FILE"
+
+func defaultKeyStore() keyStore{
+	if path := os.Getenv(keyFileEnv); path != ""{
+		return newFileKeyStore(path)
+	}
+	return newMemoryKeyStore()
+}
+
+// keyStore maps a logical operation to its idempotency key.
+type keyStore interface{
+	Get(op string) (string, bool)
+	Put(op, key string) error
+	Delete(op string) error
+}
+
+// operationID identifies a registration, the same package registered again is the same operation.
+func operationID(data pkgData) string{
+	return data.Name + "@" + data.Version
+}
+
+// newIdempotencyKey returns a random UUID (version 4).
+func newIdempotencyKey() (string, error){
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil{
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// inProgressError is the 409 sent while a request with the same key is being processed.
+type inProgressError struct{
+	*ProblemError
+	retryAfter	time.Duration
+}
+
+func (e *inProgressError) Unwrap() error{
+	return e.ProblemError
+}
+
+// checkInProgress returns an *inProgressError if the response says the key is being processed, problem otherwise.
+func checkInProgress(resp *http.Response, problem *ProblemError) error{
+	if resp.StatusCode != http.StatusConflict{
+		return problem
+	}
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0{
+		return &inProgressError{ProblemError: problem, retryAfter: time.Duration(seconds) *time.Second}
+	}
+	if date, err := http.ParseTime(value); err == nil{
+		return &inProgressError{ProblemError: problem, retryAfter: time.Until(date)}
+	}
+	//no Retry-After, the conflict is not temporary
+	return problem
+}
+
+// retryable reports whether the registration may succeed if sent again with the same key.
+func retryable(err error) bool{
+	var problem *ProblemError
+	if errors.As(err, &problem){
+		return problem.Status >= 500 || problem.Status == http.StatusTooManyRequests
+	}
+	//the error of a JSON response that could not be decoded is not worth a retry
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr)
+}
+
+// sleep waits for d, it returns the error of ctx if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error{
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select{
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// register posts b to url with the key of op, reusing the stored key if the operation is in flight.
+func (o registerOptions) register(ctx context.Context, url string, b []byte, op string) (p pkgRegisterResult, err error){
+	client := o.Client
+	if client == nil{
+		client = http.DefaultClient
+	}
+	keys := o.Keys
+	if keys == nil{
+		keys = newMemoryKeyStore()
+	}
+	//the same package sent to another registry is another operation
+	op = url + " " + op
+
+	maxWait := o.MaxRetryAfter
+	if maxWait <= 0{
+		maxWait = maxRetryAfter
+	}
+
+	key, ok := keys.Get(op)
+	if !ok{
+		if key, err = newIdempotencyKey(); err != nil{
+			return p, err
+		}
+		if err := keys.Put(op, key); err != nil{
+			return p, err
+		}
+	}
+	//whatever the outcome, the key is not needed anymore: kept, it would replay a stored failure
+	defer func(){
+		if delErr := keys.Delete(op); err == nil{
+			err = delErr
+		}
+	}()
+
+	backoff := o.Backoff
+	retries, waits := 0, 0
+	for{
+		p, err = postPackageData(ctx, client, url, b, key)
+		var busy *inProgressError
+		var wait time.Duration
+		switch{
+		case errors.As(err, &busy):
+			//the first request is still running, its outcome is not known yet
+			if waits == o.InProgressRetries{
+				return p, err
+			}
+			waits++
+			wait = busy.retryAfter
+			if wait > maxWait{
+				wait = maxWait
+			}
+		case err == nil || !retryable(err) || retries == o.Retries:
+			return p, err
+		default:
+			retries++
+			wait = backoff
+			backoff *= 2
+		}
+		if err := sleep(ctx, wait); err != nil{
+			return p, err
+		}
+	}
+}
+
+type memoryKeyStore struct{
+	mu		sync.Mutex
+	keys	map[string]string
+}
+
+func newMemoryKeyStore() *memoryKeyStore{
+	return &memoryKeyStore{keys: map[string]string{}}
+}
+
+func (s *memoryKeyStore) Get(op string) (string, bool){
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[op]
+	return key, ok
+}
+
+func (s *memoryKeyStore) Put(op, key string) error{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[op] = key
+	return nil
+}
+
+func (s *memoryKeyStore) Delete(op string) error{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, op)
+	return nil
+}
+
+// fileKeyStore keeps the keys in a JSON file, so that they survive a restart of the program.
+type fileKeyStore struct{
+	mu		sync.Mutex
+	path	string
+}
+
+func newFileKeyStore(path string) *fileKeyStore{
+	return &fileKeyStore{path: path}
+}
+
+func (s *fileKeyStore) load() (map[string]string, error){
+	keys := map[string]string{}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist){
+		return keys, nil
+	}
+	if err != nil{
+		return nil, err
+	}
+	if len(data) > 0{
+		err = json.Unmarshal(data, &keys)
+	}
+	return keys, err
+}
+
+// save writes the keys to a temporary file renamed over the store, a crash never leaves half a file.
+func (s *fileKeyStore) save(keys map[string]string) error{
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil{
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil{
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil{
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil{
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil{
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (s *fileKeyStore) Get(op string) (string, bool){
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := s.load()
+	if err != nil{
+		return "", false
+	}
+	key, ok := keys[op]
+	return key, ok
+}
+
+func (s *fileKeyStore) Put(op, key string) error{
+	return s.update(func(keys map[string]string){ keys[op] = key })
+}
+
+func (s *fileKeyStore) Delete(op string) error{
+	return s.update(func(keys map[string]string){ delete(keys, op) })
+}
+
+func (s *fileKeyStore) update(change func(map[string]string)) error{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := s.load()
+	if err != nil{
+		return err
+	}
+	change(keys)
+	return s.save(keys)
+}
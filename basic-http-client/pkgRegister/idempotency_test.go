@@ -0,0 +1,290 @@
+package pkgregister
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// keyRecorder records the Idempotency-Key of each request before passing it to next.
+type keyRecorder struct{
+	mu		sync.Mutex
+	keys	[]string
+	next	http.Handler
+}
+
+func (k *keyRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request){
+	k.mu.Lock()
+	k.keys = append(k.keys, r.Header.Get("Idempotency-Key"))
+	k.mu.Unlock()
+	k.next.ServeHTTP(w, r)
+}
+
+func (k *keyRecorder) recorded() []string{
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return append([]string(nil), k.keys...)
+}
+
+func (h *idempotentHandler) registrations() int{
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.processed
+}
+
+// slowOnce registers the package, then answers the first request after delay: the client times out after the commit.
+func slowOnce(delay time.Duration) http.Handler{
+	var once sync.Once
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		packageRegHandler(w, r)
+		once.Do(func(){ time.Sleep(delay) })
+	})
+}
+
+func TestNewIdempotencyKey(t *testing.T){
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, err := newIdempotencyKey()
+	if err != nil{
+		t.Fatal(err)
+	}
+	b, _ := newIdempotencyKey()
+	if !uuid.MatchString(a) || a == b{
+		t.Errorf("Expected two different UUIDs, Got: %s and %s", a, b)
+	}
+}
+
+func TestRegisterRetryAfterTimeoutIsReplayed(t *testing.T){
+	registry := newIdempotentHandler(slowOnce(300 *time.Millisecond))
+	recorder := &keyRecorder{next: registry}
+	ts := httptest.NewServer(recorder)
+	defer ts.Close()
+
+	// the retry comes while the first request is in progress, the server asks to come back 1s later
+	opts := registerOptions{Client: &http.Client{Timeout: 100 *time.Millisecond}, Retries: 5, Backoff: 50 *time.Millisecond, InProgressRetries: 1, Keys: newMemoryKeyStore()}
+	p, err := registerPackageDataWith(context.Background(), ts.URL, pkgData{Name: "MyPackage", Version: "0.1"}, opts)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if p.ID != "MyPackage-0.1" || !p.Replayed{
+		t.Errorf("Expected the replayed result MyPackage-0.1, Got: %+v", p)
+	}
+	if registry.registrations() != 1{
+		t.Errorf("Expected the package to be registered once, Got: %d", registry.registrations())
+	}
+	keys := recorder.recorded()
+	if len(keys) < 2{
+		t.Fatalf("Expected the registration to be retried, Got: %d requests", len(keys))
+	}
+	for _, key := range keys{
+		if key == "" || key != keys[0]{
+			t.Errorf("Expected every attempt to send the same key, Got: %v", keys)
+		}
+	}
+	if _, ok := opts.Keys.Get(ts.URL + " MyPackage@0.1"); ok{
+		t.Errorf("Expected the key to be deleted after the registration")
+	}
+}
+
+func TestRegisterKeyPersistedAcrossRuns(t *testing.T){
+	registry := newIdempotentHandler(slowOnce(300 *time.Millisecond))
+	recorder := &keyRecorder{next: registry}
+	ts := httptest.NewServer(recorder)
+	defer ts.Close()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data := pkgData{Name: "MyPackage", Version: "0.1"}
+
+	// the first run stores its key and crashes while its request times out
+	key, _ := newIdempotencyKey()
+	if err := newFileKeyStore(path).Put(ts.URL+" MyPackage@0.1", key); err != nil{
+		t.Fatal(err)
+	}
+	client := &http.Client{Timeout: 100 *time.Millisecond}
+	if _, err := postPackageData(context.Background(), client, ts.URL, []byte(`{"name":"MyPackage","version":"0.1"}`), key); err == nil{
+		t.Fatal("Expected the first run to time out")
+	}
+
+	// wait for the server to finish the first request, then run again with a new store
+	time.Sleep(300 *time.Millisecond)
+	opts := registerOptions{Client: client, Keys: newFileKeyStore(path)}
+	p, err := registerPackageDataWith(context.Background(), ts.URL, data, opts)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if !p.Replayed || registry.registrations() != 1{
+		t.Errorf("Expected a replay of the first registration, Got: %+v after %d registrations", p, registry.registrations())
+	}
+	if keys := recorder.recorded(); len(keys) != 2 || keys[0] != keys[1]{
+		t.Errorf("Expected both runs to send the same key, Got: %v", keys)
+	}
+	if _, ok := opts.Keys.Get(ts.URL + " MyPackage@0.1"); ok{
+		t.Errorf("Expected the key to be deleted after the registration")
+	}
+}
+
+func TestRegisterNewKeyPerRegistration(t *testing.T){
+	recorder := &keyRecorder{next: newIdempotentHandler(http.HandlerFunc(packageRegHandler))}
+	ts := httptest.NewServer(recorder)
+	defer ts.Close()
+
+	for _, data := range []pkgData{{Name: "MyPackage", Version: "0.1"}, {Name: "MyPackage", Version: "0.2"}}{
+		p, err := registerPackageData(ts.URL, data)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if p.Replayed{
+			t.Errorf("Expected a new registration of %s, Got a replay", p.ID)
+		}
+	}
+	if keys := recorder.recorded(); len(keys) != 2 || keys[0] == keys[1]{
+		t.Errorf("Expected a key per registration, Got: %v", keys)
+	}
+}
+
+func TestRegisterKeyReusedWithAnotherPayload(t *testing.T){
+	registry := newIdempotentHandler(http.HandlerFunc(packageRegHandler))
+	ts := httptest.NewServer(registry)
+	defer ts.Close()
+
+	client := &http.Client{}
+	if _, err := postPackageData(context.Background(), client, ts.URL, []byte(`{"name":"a","version":"1.0"}`), "key"); err != nil{
+		t.Fatal(err)
+	}
+	// a stale store gives the same key to another package: 422, which is not retried
+	keys := newMemoryKeyStore()
+	keys.Put(ts.URL+" b@1.0", "key")
+	opts := registerOptions{Client: client, Retries: 3, Backoff: time.Second, Keys: keys}
+	start := time.Now()
+	_, err := registerPackageDataWith(context.Background(), ts.URL, pkgData{Name: "b", Version: "1.0"}, opts)
+	var problem *ProblemError
+	if !errors.As(err, &problem) || problem.Status != http.StatusUnprocessableEntity{
+		t.Fatalf("Expected a 422 *ProblemError, Got: %v", err)
+	}
+	if time.Since(start) > time.Second{
+		t.Errorf("Expected no retry after a 422")
+	}
+	if _, ok := keys.Get(ts.URL + " b@1.0"); ok{
+		t.Errorf("Expected the rejected key to be deleted")
+	}
+}
+
+// startConflictServer answers every registration with a 409, with retryAfter as Retry-After if not empty.
+func startConflictServer(retryAfter string, requests *int) *httptest.Server{
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if retryAfter != ""{
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		http.Error(w, "Conflict", http.StatusConflict)
+	}))
+}
+
+func TestRegisterConflict(t *testing.T){
+	// already registered: final, the key is dropped
+	requests := 0
+	ts := startConflictServer("", &requests)
+	defer ts.Close()
+	opts := registerOptions{Retries: 3, Backoff: time.Millisecond, InProgressRetries: 3, Keys: newMemoryKeyStore()}
+	_, err := registerPackageDataWith(context.Background(), ts.URL, pkgData{Name: "MyPackage", Version: "0.1"}, opts)
+	var problem *ProblemError
+	if !errors.As(err, &problem) || problem.Status != http.StatusConflict{
+		t.Fatalf("Expected a 409 *ProblemError, Got: %v", err)
+	}
+	if requests != 1{
+		t.Errorf("Expected no retry after a 409, Got: %d requests", requests)
+	}
+	if _, ok := opts.Keys.Get(ts.URL + " MyPackage@0.1"); ok{
+		t.Errorf("Expected the key to be deleted after a 409")
+	}
+
+	// still in progress after InProgressRetries: the key is dropped all the same
+	requests = 0
+	busy := startConflictServer("0", &requests)
+	defer busy.Close()
+	_, err = registerPackageDataWith(context.Background(), busy.URL, pkgData{Name: "MyPackage", Version: "0.1"}, opts)
+	if !errors.As(err, &problem) || problem.Status != http.StatusConflict{
+		t.Fatalf("Expected a 409 *ProblemError, Got: %v", err)
+	}
+	if requests != 4{
+		t.Errorf("Expected the request and 3 retries while in progress, Got: %d requests", requests)
+	}
+	if _, ok := opts.Keys.Get(busy.URL + " MyPackage@0.1"); ok{
+		t.Errorf("Expected the key to be deleted once the retries ran out")
+	}
+}
+
+func TestRegisterKeyDroppedAfterServerError(t *testing.T){
+	recorder := &keyRecorder{next: newIdempotentHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "storage unavailable", http.StatusServiceUnavailable)
+	}))}
+	ts := httptest.NewServer(recorder)
+	defer ts.Close()
+
+	opts := registerOptions{Retries: 2, Backoff: time.Millisecond, Keys: newMemoryKeyStore()}
+	for i := 0; i < 2; i++{
+		_, err := registerPackageDataWith(context.Background(), ts.URL, pkgData{Name: "MyPackage", Version: "0.1"}, opts)
+		var problem *ProblemError
+		if !errors.As(err, &problem) || problem.Status != http.StatusServiceUnavailable{
+			t.Fatalf("Expected a 503 *ProblemError, Got: %v", err)
+		}
+		if _, ok := opts.Keys.Get(ts.URL + " MyPackage@0.1"); ok{
+			t.Errorf("Expected the key to be deleted once the retries ran out")
+		}
+	}
+	// the stored 503 is replayed to the retries, not to the next registration
+	keys := recorder.recorded()
+	if len(keys) != 6 || keys[0] != keys[2] || keys[2] == keys[3]{
+		t.Errorf("Expected 3 requests with a key, then 3 with a new one, Got: %v", keys)
+	}
+}
+
+func TestRegisterRetryAfterIsCapped(t *testing.T){
+	requests := 0
+	ts := startConflictServer("3600", &requests)
+	defer ts.Close()
+
+	opts := registerOptions{InProgressRetries: 2, MaxRetryAfter: 10 *time.Millisecond}
+	start := time.Now()
+	if _, err := registerPackageDataWith(context.Background(), ts.URL, pkgData{Name: "MyPackage", Version: "0.1"}, opts); err == nil{
+		t.Fatal("Expected the registration to fail while the server is busy")
+	}
+	if requests != 3 || time.Since(start) > time.Second{
+		t.Errorf("Expected 3 requests without waiting an hour, Got: %d in %s", requests, time.Since(start))
+	}
+
+	// the wait ends with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50 *time.Millisecond)
+	defer cancel()
+	opts.MaxRetryAfter = time.Hour
+	start = time.Now()
+	if _, err := registerPackageDataWith(ctx, ts.URL, pkgData{Name: "MyPackage", Version: "0.1"}, opts); !errors.Is(err, context.DeadlineExceeded){
+		t.Errorf("Expected the deadline of the context, Got: %v", err)
+	}
+	if time.Since(start) > time.Second{
+		t.Errorf("Expected the wait to end with the context, Got: %s", time.Since(start))
+	}
+}
+
+func TestDefaultKeyStore(t *testing.T){
+	// the store is chosen by each call, not once at init
+	t.Setenv(keyFileEnv, "")
+	if _, ok := defaultKeyStore().(*memoryKeyStore); !ok{
+		t.Errorf("Expected the keys to be kept in memory without %s", keyFileEnv)
+	}
+
+	path := filepath.Join(t.TempDir(), "pkgregister", "keys.json")
+	t.Setenv(keyFileEnv, path)
+	keys := defaultRegisterOptions().Keys
+	if err := keys.Put("op", "key"); err != nil{
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil{
+		t.Errorf("Expected the keys to be written to %s, Got: %v", path, err)
+	}
+}
@@ -2,8 +2,8 @@ package pkgregister
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"io"
 	"net/http"
 )
@@ -15,24 +15,48 @@ type pkgData struct{
 
 type pkgRegisterResult struct{
 	ID string	`json:"id"`
+	//Replayed is true when the server answered with the stored result of an earlier attempt (Idempotent-Replayed header)
+	Replayed bool	`json:"-"`
 }
 
 func registerPackageData(url string, data pkgData) (pkgRegisterResult, error){
+	return registerPackageDataWith(context.Background(), url, data, defaultRegisterOptions())
+}
+
+func registerPackageDataWith(ctx context.Context, url string, data pkgData, opts registerOptions) (pkgRegisterResult, error){
 	//make an instance of pkgRegisterResult
 	p := pkgRegisterResult{}
+	//check the payload before sending it, the server would only report the first problem
+	if err := validatePackageData(data); err != nil{
+		return p, err
+	}
 	//serialize the data as JSON to send it to the server as request body
 	b, err := json.Marshal(data)
 	//handle the error
 	if err != nil{
 		return p, err
 	}
+	//every attempt of this registration sends the same Idempotency-Key, see idempotency.go
+	return opts.register(ctx, url, b, operationID(data))
+}
+
+//postPackageData sends one attempt of the registration
+func postPackageData(ctx context.Context, client *http.Client, url string, b []byte, key string) (pkgRegisterResult, error){
+	p := pkgRegisterResult{}
 	//we will create an io.Reader object for this byte slice(returned by json.Marshal) using the NewReader() function from the bytes package.
 	//The io.Reader interface represents a stream of data that can be read.
 	//By accepting an io.Reader, the Post function allows you to provide the request body from different sources: a file, a network connection, or any other source that implements the io.Reader interface.
 	//Using an io.Reader allows for streaming data, which is useful when dealing with large datasets. You can read and send the data in chunks without loading the entire payload into memory.
 	//If you have a large payload, creating a bytes.Reader from the byte slice allows you to avoid loading the entire payload into memory at once.
 	reader := bytes.NewReader(b)
-	response, err := http.Post(url, "application/json", reader)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, reader)
+	//handle the error
+	if err != nil{
+		return p, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Idempotency-Key", key)
+	response, err := client.Do(request)
 	//handle the error
 	if err != nil{
 		return p, err
@@ -47,10 +71,12 @@ func registerPackageData(url string, data pkgData) (pkgRegisterResult, error){
 	}
 
 	if response.StatusCode != http.StatusOK{
-		return p, errors.New(string(responseData))
+		//decode the problem details (or the error message) sent by the server
+		return p, checkInProgress(response, newProblemError(response, responseData))
 	}
 
 	err = json.Unmarshal(responseData, &p)
+	p.Replayed = response.Header.Get("Idempotent-Replayed") == "true"
 	return p, err
 
 }
\ No newline at end of file
@@ -1,11 +1,13 @@
 package pkgregister
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 )
 
@@ -46,11 +48,86 @@ func packageRegHandler(w http.ResponseWriter, r* http.Request){
 	}
 }
 
+//idempotentHandler honors the Idempotency-Key header in front of a handler: the response to the first request
+//with a key is stored, and replayed with Idempotent-Replayed: true for the next requests with that key
+type idempotentHandler struct{
+	mu			sync.Mutex
+	next		http.Handler
+	responses	map[string]*storedResponse
+	//processed counts the requests that reached next
+	processed	int
+}
+
+type storedResponse struct{
+	request		[]byte
+	done		bool
+	status		int
+	header		http.Header
+	body		[]byte
+}
+
+func newIdempotentHandler(next http.Handler) *idempotentHandler{
+	return &idempotentHandler{next: next, responses: map[string]*storedResponse{}}
+}
+
+func (h *idempotentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request){
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" || r.Method != "POST"{
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil{
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.mu.Lock()
+	if s, ok := h.responses[key]; ok{
+		//copy it under the lock, the first request may still be filling it
+		stored := *s
+		h.mu.Unlock()
+		switch{
+		case !bytes.Equal(stored.request, data):
+			http.Error(w, "Idempotency-Key reused with another payload", http.StatusUnprocessableEntity)
+		case !stored.done:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "a request with this Idempotency-Key is in progress", http.StatusConflict)
+		default:
+			for name, values := range stored.header{
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.status)
+			w.Write(stored.body)
+		}
+		return
+	}
+	stored := &storedResponse{request: data}
+	h.responses[key] = stored
+	h.processed++
+	h.mu.Unlock()
+
+	//record the response to store it, then send it
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	rec := httptest.NewRecorder()
+	h.next.ServeHTTP(rec, r)
+
+	h.mu.Lock()
+	stored.done, stored.status, stored.header, stored.body = true, rec.Code, rec.Header().Clone(), rec.Body.Bytes()
+	h.mu.Unlock()
+	for name, values := range rec.Header(){
+		w.Header()[name] = values
+	}
+	w.WriteHeader(rec.Code)
+	w.Write(rec.Body.Bytes())
+}
+
 //make a test server to check if or not the post req. goes through properly
 //above function handles the post request, the function below, returns a server
 func startTestPackageServer() *httptest.Server{
-	//creating a server instance
-	ts := httptest.NewServer(http.HandlerFunc(packageRegHandler))
+	//creating a server instance, which honors the idempotency keys like the registry
+	ts := httptest.NewServer(newIdempotentHandler(http.HandlerFunc(packageRegHandler)))
 	return ts
 }
 
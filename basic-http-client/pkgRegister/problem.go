@@ -0,0 +1,25 @@
+/*
+	Error responses are decoded by the registry package: RFC 7807
+	application/problem+json, the common {"error": ...} / {"message": ...}
+	shapes and plain text all end up in a *ProblemError, and the caller
+	gets it back with errors.As:
+
+		var problem *ProblemError
+		if errors.As(err, &problem) && problem.Status == http.StatusConflict{ ... }
+
+*/
+
+package pkgregister
+
+import (
+	"net/http"
+
+	"github.com/Praveen005/Go-http-client/tree/main/basic-http-client/registry"
+)
+
+type ProblemError = registry.ProblemError
+
+// newProblemError decodes the body of an error response.
+func newProblemError(resp *http.Response, body []byte) *ProblemError{
+	return registry.DecodeProblem(resp, body)
+}
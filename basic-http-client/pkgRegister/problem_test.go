@@ -0,0 +1,47 @@
+package pkgregister
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// startErrorServer answers every request with status, contentType and body.
+func startErrorServer(status int, contentType, body string) *httptest.Server{
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestRegisterProblemDetails(t *testing.T){
+	ts := startErrorServer(http.StatusUnprocessableEntity, "application/problem+json", `{
+		"type": "https://registry.example.com/probs/invalid-package",
+		"title": "Invalid package",
+		"status": 422,
+		"detail": "1 field is invalid",
+		"instance": "/packages/requests/42",
+		"invalid-params": [{"name": "version", "reason": "already registered"}],
+		"request_id": "42"
+	}`)
+	defer ts.Close()
+
+	_, err := registerPackageData(ts.URL, pkgData{Name: "MyPackage", Version: "0.1"})
+	var problem *ProblemError
+	if !errors.As(err, &problem){
+		t.Fatalf("Expected a *ProblemError, Got: %T %v", err, err)
+	}
+	if problem.Type != "https://registry.example.com/probs/invalid-package" || problem.Title != "Invalid package" ||
+		problem.Status != 422 || problem.Detail != "1 field is invalid" || problem.Instance != "/packages/requests/42"{
+		t.Errorf("Expected the standard members to be decoded, Got: %+v", problem)
+	}
+	if problem.Extensions["request_id"] != "42" || len(problem.Extensions) != 2{
+		t.Errorf("Expected the extensions request_id and invalid-params, Got: %v", problem.Extensions)
+	}
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "version" || problem.Errors[0].Message != "already registered"{
+		t.Errorf("Expected a field error for version, Got: %v", problem.Errors)
+	}
+}
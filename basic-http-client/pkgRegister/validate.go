@@ -0,0 +1,37 @@
+/*
+	Without validation, registerPackageData sends whatever is in pkgData
+	and we only learn from a "Bad Request" that the name was empty, one
+	problem per round trip.
+
+	The rules are the ones of the registry package (registry.ValidatePackageData),
+	checked before any network call, with every problem reported at once:
+
+		name: must not be empty
+		version: "1.0.0.0" is not a semantic version (MAJOR.MINOR.PATCH)
+
+	FieldError and ValidationErrors are aliases of the registry types, so
+	errors.As works with either name:
+
+		var verrs ValidationErrors
+		if errors.As(err, &verrs){
+			for _, fe := range verrs{ ... }
+		}
+
+*/
+
+package pkgregister
+
+import (
+	"github.com/Praveen005/Go-http-client/tree/main/basic-http-client/registry"
+)
+
+// FieldError is one problem with one member of the JSON payload.
+type FieldError = registry.FieldError
+
+// ValidationErrors lists every problem found in a payload.
+type ValidationErrors = registry.ValidationErrors
+
+// validatePackageData returns a ValidationErrors with every problem of data, or nil.
+func validatePackageData(data pkgData) error{
+	return registry.ValidatePackageData(registry.PackageData{Name: data.Name, Version: data.Version})
+}
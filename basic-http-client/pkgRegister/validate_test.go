@@ -0,0 +1,26 @@
+package pkgregister
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegisterInvalidPackageDataNoRequest(t *testing.T){
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		packageRegHandler(w, r)
+	}))
+	defer ts.Close()
+
+	_, err := registerPackageData(ts.URL, pkgData{Name: "", Version: "one"})
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) || len(verrs) != 2{
+		t.Fatalf("Expected 2 validation errors, Got: %v", err)
+	}
+	if requests != 0{
+		t.Errorf("Expected no request to be sent, Got: %d", requests)
+	}
+}
@@ -2,8 +2,11 @@ package pkgquery
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strings"
 )
 
 type pkgData struct{
@@ -11,6 +14,24 @@ type pkgData struct{
 	Version string		`json:"version"`
 }
 
+// unsupportedMediaTypeError is returned when the response is not JSON, instead of an empty list.
+type unsupportedMediaTypeError struct{
+	mediaType	string
+}
+
+func (e *unsupportedMediaTypeError) Error() string{
+	return fmt.Sprintf("unsupported media type %q, expected application/json", e.mediaType)
+}
+
+//comparing the header as a string would reject "application/json; charset=utf-8",
+//ParseMediaType drops the parameters and lower-cases the type
+func checkJSON(resp *http.Response) error{
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")){
+		return &unsupportedMediaTypeError{mediaType: mediaType}
+	}
+	return nil
+}
 
 func fetchPackageData(url string) ([]pkgData, error){
 	//make an instance of pkgData struct
@@ -26,8 +47,8 @@ func fetchPackageData(url string) ([]pkgData, error){
 	defer resp.Body.Close()
 
 	//check if the content type mentioned in response header is Json or not
-	if resp.Header.Get("Content-Type") != "application/json"{
-		return packages, nil
+	if err := checkJSON(resp); err != nil{
+		return packages, err
 	}
 
 	//now if your program execution is here means, you got a json response
@@ -43,4 +64,4 @@ func fetchPackageData(url string) ([]pkgData, error){
 	err = json.Unmarshal(data, &packages)
 
 	return packages, err
-}
\ No newline at end of file
+}
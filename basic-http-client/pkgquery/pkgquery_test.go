@@ -45,4 +45,26 @@ func TestFetchPackageData(t *testing.T){
 	if len(packages) != 2{
 		t.Fatalf("Expected 2 packages, Got back: %d", len(packages))
 	}
-}
\ No newline at end of file
+}
+
+func TestFetchPackageDataContentType(t *testing.T){
+	for contentType, valid := range map[string]bool{
+		"application/json; charset=utf-8":	true,
+		"application/vnd.registry+json":	true,
+		"text/html":						false,
+	}{
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			fmt.Fprint(w, `[{"name":"package1","version":"1.1"}]`)
+		}))
+		packages, err := fetchPackageData(ts.URL)
+		ts.Close()
+
+		if valid && (err != nil || len(packages) != 1){
+			t.Errorf("Expected 1 package for %s, Got: %d, %v", contentType, len(packages), err)
+		}
+		if _, ok := err.(*unsupportedMediaTypeError); !valid && !ok{
+			t.Errorf("Expected an unsupported media type error for %s, Got: %v", contentType, err)
+		}
+	}
+}
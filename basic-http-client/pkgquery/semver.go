@@ -0,0 +1,381 @@
+/*
+	Package versions are plain strings in the registry, compared as strings
+	"1.10.0" < "1.9.0". parseVersion parses them as semantic versions
+	(https://semver.org):
+
+		MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD]
+
+	A leading "v" is accepted, and so are missing minor/patch numbers
+	("1.1" is 1.1.0), since older packages were registered that way.
+	Precedence follows the spec: numbers compare numerically, a
+	pre-release is lower than its release (1.0.0-rc.1 < 1.0.0), the build
+	metadata is ignored.
+
+	A constraint is a set of comparators, separated by spaces (and) and ||
+	(or):
+
+		1.2.3, =1.2.3		exactly 1.2.3
+		>1.2, >=1.2, <2, <=2.1.0, !=1.4.0
+		^1.2				>=1.2.0 <2.0.0, ^0.2 is >=0.2.0 <0.3.0 and ^0.0.3 is >=0.0.3 <0.0.4
+		~1.2				>=1.2.0 <1.3.0, ~1 is >=1.0.0 <2.0.0
+		1.2.x, 1.*			same as ~1.2 and ~1
+		*					any release
+		>=1.0 <2.0 || >=3.0
+
+	As with npm, a pre-release only satisfies a constraint mentioning a
+	pre-release of the same MAJOR.MINOR.PATCH: ">=1.0.0-beta <2" matches
+	1.0.0-rc.1 but not 1.5.0-alpha.
+
+*/
+
+package pkgquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type version struct{
+	Major		uint64
+	Minor		uint64
+	Patch		uint64
+	// Prerelease holds the dot separated identifiers after '-', e.g. ["rc", "1"].
+	Prerelease	[]string
+	Build		string
+}
+
+func parseVersion(s string) (version, error){
+	var v version
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(rest, "+"); i >= 0{
+		v.Build = rest[i+1:]
+		rest = rest[:i]
+		if v.Build == ""{
+			return version{}, fmt.Errorf("invalid version %q: empty build metadata", s)
+		}
+	}
+	if i := strings.Index(rest, "-"); i >= 0{
+		for _, id := range strings.Split(rest[i+1:], "."){
+			if id == "" || !isAlphanumeric(id){
+				return version{}, fmt.Errorf("invalid version %q: bad pre-release identifier %q", s, id)
+			}
+			if isNumeric(id) && len(id) > 1 && id[0] == '0'{
+				return version{}, fmt.Errorf("invalid version %q: leading zero in %q", s, id)
+			}
+			v.Prerelease = append(v.Prerelease, id)
+		}
+		rest = rest[:i]
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3{
+		return version{}, fmt.Errorf("invalid version %q: too many numbers", s)
+	}
+	numbers := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts{
+		n, err := parseNumber(p)
+		if err != nil{
+			return version{}, fmt.Errorf("invalid version %q: %w", s, err)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+func parseNumber(p string) (uint64, error){
+	if p == "" || !isNumeric(p){
+		return 0, fmt.Errorf("%q is not a number", p)
+	}
+	if len(p) > 1 && p[0] == '0'{
+		return 0, fmt.Errorf("leading zero in %q", p)
+	}
+	return strconv.ParseUint(p, 10, 64)
+}
+
+func isNumeric(s string) bool{
+	for _, r := range s{
+		if r < '0' || r > '9'{
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isAlphanumeric(s string) bool{
+	for _, r := range s{
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-'){
+			return false
+		}
+	}
+	return true
+}
+
+func (v version) String() string{
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0{
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if v.Build != ""{
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Stable reports whether v is a release, not a pre-release. 0.x releases are stable too:
+// many packages never reach 1.0.0.
+func (v version) Stable() bool{
+	return len(v.Prerelease) == 0
+}
+
+func cmpUint(a, b uint64) int{
+	switch{
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or greater than o, ignoring the build metadata.
+func (v version) Compare(o version) int{
+	if c := cmpUint(v.Major, o.Major); c != 0{
+		return c
+	}
+	if c := cmpUint(v.Minor, o.Minor); c != 0{
+		return c
+	}
+	if c := cmpUint(v.Patch, o.Patch); c != 0{
+		return c
+	}
+	// a release is greater than its pre-releases
+	switch{
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++{
+		a, b := v.Prerelease[i], o.Prerelease[i]
+		if a == b{
+			continue
+		}
+		aNum, bNum := isNumeric(a), isNumeric(b)
+		switch{
+		case aNum && bNum:
+			x, _ := strconv.ParseUint(a, 10, 64)
+			y, _ := strconv.ParseUint(b, 10, 64)
+			return cmpUint(x, y)
+		case aNum:
+			// numeric identifiers are lower than alphanumeric ones
+			return -1
+		case bNum:
+			return 1
+		case a < b:
+			return -1
+		default:
+			return 1
+		}
+	}
+	return cmpUint(uint64(len(v.Prerelease)), uint64(len(o.Prerelease)))
+}
+
+type comparator struct{
+	op	string
+	v	version
+}
+
+func (c comparator) check(v version) bool{
+	r := v.Compare(c.v)
+	switch c.op{
+	case "=":
+		return r == 0
+	case "!=":
+		return r != 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	}
+	return false
+}
+
+type constraint struct{
+	raw		string
+	// groups are or'ed, the comparators of a group are and'ed
+	groups	[][]comparator
+}
+
+func parseConstraint(s string) (*constraint, error){
+	c := &constraint{raw: s}
+	for _, group := range strings.Split(s, "||"){
+		fields := strings.Fields(group)
+		if len(fields) == 0{
+			return nil, fmt.Errorf("invalid constraint %q: empty range", s)
+		}
+		var comparators []comparator
+		for _, f := range fields{
+			cs, err := parseComparator(f)
+			if err != nil{
+				return nil, fmt.Errorf("invalid constraint %q: %w", s, err)
+			}
+			comparators = append(comparators, cs...)
+		}
+		c.groups = append(c.groups, comparators)
+	}
+	return c, nil
+}
+
+// partial is a version with possibly missing or wildcard (x, X, *) numbers.
+type partial struct{
+	v		version
+	// parts is the number of numbers given, before any wildcard
+	parts	int
+}
+
+func parsePartial(s string) (partial, error){
+	core := strings.TrimPrefix(s, "v")
+	suffix := ""
+	if i := strings.IndexAny(core, "-+"); i >= 0{
+		core, suffix = core[:i], core[i:]
+	}
+	fields := strings.Split(core, ".")
+	if len(fields) > 3{
+		return partial{}, fmt.Errorf("too many numbers in %q", s)
+	}
+	parts := 0
+	for _, f := range fields{
+		if f == "x" || f == "X" || f == "*"{
+			break
+		}
+		parts++
+	}
+	for _, f := range fields[parts:]{
+		if f != "x" && f != "X" && f != "*"{
+			return partial{}, fmt.Errorf("number after a wildcard in %q", s)
+		}
+	}
+	if parts < len(fields) && suffix != ""{
+		return partial{}, fmt.Errorf("pre-release with a wildcard in %q", s)
+	}
+	if parts == 0{
+		return partial{}, nil
+	}
+	v, err := parseVersion(strings.Join(fields[:parts], ".") + suffix)
+	if err != nil{
+		return partial{}, err
+	}
+	return partial{v: v, parts: parts}, nil
+}
+
+// bump returns the lowest version above every version starting with the first n numbers of v.
+func bump(v version, n int) version{
+	switch n{
+	case 1:
+		return version{Major: v.Major + 1}
+	case 2:
+		return version{Major: v.Major, Minor: v.Minor + 1}
+	}
+	return version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+}
+
+// parseComparator expands one comparator of a constraint (^1.2, 1.x, >=1.0...) into plain comparisons.
+func parseComparator(s string) ([]comparator, error){
+	op := ""
+	for _, candidate := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"}{
+		if strings.HasPrefix(s, candidate){
+			op = candidate
+			break
+		}
+	}
+	p, err := parsePartial(s[len(op):])
+	if err != nil{
+		return nil, err
+	}
+	if p.parts == 0{
+		switch op{
+		case "", "=", ">=", "^", "~":
+			// any version
+			return []comparator{{">=", version{}}}, nil
+		}
+		return nil, fmt.Errorf("wildcard with %s in %q", op, s)
+	}
+
+	switch op{
+	case "^":
+		// the first non-zero number may not change
+		n := 1
+		switch{
+		case p.v.Major == 0 && p.parts >= 2 && p.v.Minor == 0 && p.parts == 3:
+			n = 3
+		case p.v.Major == 0 && p.parts >= 2:
+			n = 2
+		}
+		return []comparator{{">=", p.v}, {"<", bump(p.v, n)}}, nil
+	case "~":
+		n := 2
+		if p.parts == 1{
+			n = 1
+		}
+		return []comparator{{">=", p.v}, {"<", bump(p.v, n)}}, nil
+	case "", "=":
+		if p.parts == 3{
+			return []comparator{{"=", p.v}}, nil
+		}
+		// 1.2 and 1.2.x mean any 1.2.z
+		return []comparator{{">=", p.v}, {"<", bump(p.v, p.parts)}}, nil
+	case ">":
+		if p.parts < 3{
+			// >1.2 means above any 1.2.z
+			return []comparator{{">=", bump(p.v, p.parts)}}, nil
+		}
+	case "<=":
+		if p.parts < 3{
+			return []comparator{{"<", bump(p.v, p.parts)}}, nil
+		}
+	case "!=":
+		if p.parts < 3{
+			return nil, fmt.Errorf("partial version with != in %q", s)
+		}
+	}
+	return []comparator{{op, p.v}}, nil
+}
+
+// Check reports whether v satisfies the constraint.
+func (c *constraint) Check(v version) bool{
+	for _, group := range c.groups{
+		if checkGroup(group, v){
+			return true
+		}
+	}
+	return false
+}
+
+func checkGroup(group []comparator, v version) bool{
+	for _, cmp := range group{
+		if !cmp.check(v){
+			return false
+		}
+	}
+	if len(v.Prerelease) == 0{
+		return true
+	}
+	// a pre-release needs a comparator with a pre-release of the same MAJOR.MINOR.PATCH
+	for _, cmp := range group{
+		if len(cmp.v.Prerelease) > 0 && cmp.v.Major == v.Major && cmp.v.Minor == v.Minor && cmp.v.Patch == v.Patch{
+			return true
+		}
+	}
+	return false
+}
+
+func (c *constraint) String() string{
+	return c.raw
+}
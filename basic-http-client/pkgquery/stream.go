@@ -0,0 +1,122 @@
+/*
+	fetchPackageData holds the whole response in memory twice: the bytes
+	returned by io.ReadAll, then the slice json.Unmarshal builds from them.
+	With 100k packages that is megabytes for a list we often only walk once.
+
+	json.Decoder reads from the body as the bytes arrive. Token() returns
+	the opening '[' of the array, then each Decode() reads exactly one
+	element, so only one pkgData (and the decoder buffer) is in memory at a
+	time, whatever the size of the list:
+
+		[						<- dec.Token()
+			{...},				<- dec.Decode(&p), while dec.More()
+			{...},
+		]						<- dec.Token()
+
+	pkgDataStream is the iterator form (Next/Package/Err, like bufio.Scanner),
+	streamPackageData the callback form. Returning errStopStreaming from the
+	callback, or calling Close on the stream, stops early without reading
+	the rest of the body.
+
+*/
+
+package pkgquery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// errStopStreaming can be returned by the callback of streamPackageData to stop without error.
+var errStopStreaming = errors.New("stop streaming")
+
+type pkgDataStream struct{
+	body	io.ReadCloser
+	dec		*json.Decoder
+	current	pkgData
+	err		error
+	done	bool
+}
+
+// openPackageStream sends the request and checks the response, the elements are read by Next.
+func openPackageStream(url string) (*pkgDataStream, error){
+	resp, err := http.Get(url)
+	if err != nil{
+		return nil, err
+	}
+	if err := checkJSON(resp); err != nil{
+		resp.Body.Close()
+		return nil, err
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	// the list should start with '['
+	tok, err := dec.Token()
+	if err != nil{
+		resp.Body.Close()
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '['{
+		resp.Body.Close()
+		return nil, fmt.Errorf("expected a JSON array, Got: %v", tok)
+	}
+	return &pkgDataStream{body: resp.Body, dec: dec}, nil
+}
+
+// Next decodes the next element, it returns false at the end of the array or on error.
+func (s *pkgDataStream) Next() bool{
+	if s.done{
+		return false
+	}
+	if !s.dec.More(){
+		// consume the closing ']'
+		if _, err := s.dec.Token(); err != nil{
+			s.err = err
+		}
+		s.done = true
+		return false
+	}
+	s.current = pkgData{}
+	if err := s.dec.Decode(&s.current); err != nil{
+		s.err = err
+		s.done = true
+		return false
+	}
+	return true
+}
+
+func (s *pkgDataStream) Package() pkgData{
+	return s.current
+}
+
+func (s *pkgDataStream) Err() error{
+	return s.err
+}
+
+// Close releases the connection, it can be called before the end of the array.
+func (s *pkgDataStream) Close() error{
+	s.done = true
+	return s.body.Close()
+}
+
+// streamPackageData calls fn for each package as it is decoded.
+func streamPackageData(url string, fn func(pkgData) error) error{
+	s, err := openPackageStream(url)
+	if err != nil{
+		return err
+	}
+	defer s.Close()
+
+	for s.Next(){
+		if err := fn(s.Package()); err != nil{
+			if err == errStopStreaming{
+				return nil
+			}
+			return err
+		}
+	}
+	return s.Err()
+}
@@ -0,0 +1,223 @@
+package pkgquery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+// startBigPackageServer serves a JSON array of n packages, generated once.
+func startBigPackageServer(n int) *httptest.Server{
+	var b bytes.Buffer
+	b.WriteString("[")
+	for i := 0; i < n; i++{
+		if i > 0{
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `{"name":"package%d","version":"1.%d"}`, i, i%100)
+	}
+	b.WriteString("]")
+	body := b.Bytes()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	return ts
+}
+
+func TestStreamPackageData(t *testing.T){
+	ts := startBigPackageServer(1000)
+	defer ts.Close()
+
+	n := 0
+	err := streamPackageData(ts.URL, func(p pkgData) error{
+		if p.Name != fmt.Sprintf("package%d", n){
+			return fmt.Errorf("Expected package%d, Got: %s", n, p.Name)
+		}
+		n++
+		return nil
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if n != 1000{
+		t.Fatalf("Expected 1000 packages, Got back: %d", n)
+	}
+}
+
+func TestStreamPackageDataEarlyStop(t *testing.T){
+	ts := startBigPackageServer(1000)
+	defer ts.Close()
+
+	n := 0
+	err := streamPackageData(ts.URL, func(p pkgData) error{
+		n++
+		if p.Name == "package9"{
+			return errStopStreaming
+		}
+		return nil
+	})
+	if err != nil || n != 10{
+		t.Fatalf("Expected to stop after 10 packages without error, Got: %d, %v", n, err)
+	}
+
+	// any other error is returned as it is
+	errCallback := errors.New("callback failed")
+	if err := streamPackageData(ts.URL, func(p pkgData) error { return errCallback }); err != errCallback{
+		t.Errorf("Expected the callback error, Got: %v", err)
+	}
+}
+
+func TestPackageStreamIterator(t *testing.T){
+	ts := startTestPackageServer()
+	defer ts.Close()
+
+	s, err := openPackageStream(ts.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var names []string
+	for s.Next(){
+		names = append(names, s.Package().Name)
+	}
+	if s.Err() != nil{
+		t.Fatal(s.Err())
+	}
+	if len(names) != 2 || names[0] != "package1" || names[1] != "package2"{
+		t.Errorf("Expected package1 and package2, Got: %v", names)
+	}
+}
+
+func TestStreamPackageDataErrors(t *testing.T){
+	for body, expectErrAt := range map[string]string{
+		`{"name":"package1"}`:							"open",
+		`[{"name":"package1"},{"name":`:				"stream",
+	}{
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, body)
+		}))
+		s, err := openPackageStream(ts.URL)
+		if expectErrAt == "open"{
+			if err == nil{
+				t.Errorf("Expected an error for a non-array body %s", body)
+				s.Close()
+			}
+			ts.Close()
+			continue
+		}
+		if err != nil{
+			t.Fatal(err)
+		}
+		for s.Next(){
+		}
+		if s.Err() == nil{
+			t.Errorf("Expected an error for the truncated body %s", body)
+		}
+		s.Close()
+		ts.Close()
+	}
+}
+
+// heapInuse returns the heap in use by live objects, after a collection.
+func heapInuse() int64{
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return int64(m.HeapInuse)
+}
+
+// streamPeakHeap streams the packages of url and returns the largest growth of the live heap seen meanwhile.
+func streamPeakHeap(t *testing.T, url string) int64{
+	base := heapInuse()
+	var peak int64
+	n := 0
+	err := streamPackageData(url, func(p pkgData) error{
+		n++
+		if n%2000 == 0{
+			if h := heapInuse() - base; h > peak{
+				peak = h
+			}
+		}
+		return nil
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	return peak
+}
+
+func TestStreamPackageDataPeakHeap(t *testing.T){
+	if testing.Short(){
+		t.Skip("collects the heap a hundred times")
+	}
+	// both bodies are in memory before the measures start
+	small := startBigPackageServer(10000)
+	defer small.Close()
+	big := startBigPackageServer(100000)
+	defer big.Close()
+
+	smallPeak := streamPeakHeap(t, small.URL)
+	bigPeak := streamPeakHeap(t, big.URL)
+	// 10 times more packages, the memory held must not follow
+	if bigPeak > smallPeak+1<<20{
+		t.Errorf("Expected the peak heap not to grow with the number of packages, Got: %d bytes for 10k, %d bytes for 100k", smallPeak, bigPeak)
+	}
+
+	// the measure does see the growth when the whole list is kept
+	base := heapInuse()
+	packages, err := fetchPackageData(big.URL)
+	if err != nil{
+		t.Fatal(err)
+	}
+	held := heapInuse() - base
+	runtime.KeepAlive(packages)
+	t.Logf("peak heap: stream 10k %d bytes, stream 100k %d bytes, fetch 100k %d bytes", smallPeak, bigPeak, held)
+	if held < bigPeak+1<<20{
+		t.Errorf("Expected fetchPackageData to hold more than the stream, Got: %d bytes, the stream %d bytes", held, bigPeak)
+	}
+}
+
+/*
+	go test -bench . -benchmem
+
+	The B/op column is the memory allocated over one fetch of the 100k
+	packages, not the memory held at once: most of what the streaming
+	version allocates is garbage as soon as the callback returns.
+	TestStreamPackageDataPeakHeap measures the live heap instead.
+*/
+func BenchmarkFetchPackageData(b *testing.B){
+	ts := startBigPackageServer(100000)
+	defer ts.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++{
+		packages, err := fetchPackageData(ts.URL)
+		if err != nil || len(packages) != 100000{
+			b.Fatalf("Expected 100000 packages, Got: %d, %v", len(packages), err)
+		}
+	}
+}
+
+func BenchmarkStreamPackageData(b *testing.B){
+	ts := startBigPackageServer(100000)
+	defer ts.Close()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++{
+		n := 0
+		err := streamPackageData(ts.URL, func(p pkgData) error{
+			n++
+			return nil
+		})
+		if err != nil || n != 100000{
+			b.Fatalf("Expected 100000 packages, Got: %d, %v", n, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package pkgquery
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// errNoMatchingVersion is returned by resolveVersion when no version satisfies the query.
+var errNoMatchingVersion = errors.New("no matching version")
+
+// versionedPkg is a package with its parsed version.
+type versionedPkg struct{
+	pkgData
+	semver	version
+}
+
+// versionWarning reports a package whose version is not a valid semantic version.
+// Such packages are left out of the version queries, they do not fail them.
+type versionWarning struct{
+	pkg		pkgData
+	err		error
+}
+
+func (w versionWarning) String() string{
+	return fmt.Sprintf("%s %s: %v", w.pkg.Name, w.pkg.Version, w.err)
+}
+
+// sortByVersion parses the versions of packages and returns them sorted by ascending version,
+// the packages with an invalid version are returned as warnings.
+func sortByVersion(packages []pkgData) ([]versionedPkg, []versionWarning){
+	var versioned []versionedPkg
+	var warnings []versionWarning
+	for _, p := range packages{
+		v, err := parseVersion(p.Version)
+		if err != nil{
+			warnings = append(warnings, versionWarning{pkg: p, err: err})
+			continue
+		}
+		versioned = append(versioned, versionedPkg{pkgData: p, semver: v})
+	}
+	sort.SliceStable(versioned, func(i, j int) bool{
+		return versioned[i].semver.Compare(versioned[j].semver) < 0
+	})
+	return versioned, warnings
+}
+
+// latest returns the highest version, pre-releases included.
+func latest(versions []versionedPkg) (versionedPkg, bool){
+	if len(versions) == 0{
+		return versionedPkg{}, false
+	}
+	found := versions[0]
+	for _, v := range versions[1:]{
+		if v.semver.Compare(found.semver) > 0{
+			found = v
+		}
+	}
+	return found, true
+}
+
+// latestStable returns the highest version that is not a pre-release.
+func latestStable(versions []versionedPkg) (versionedPkg, bool){
+	var stable []versionedPkg
+	for _, v := range versions{
+		if v.semver.Stable(){
+			stable = append(stable, v)
+		}
+	}
+	return latest(stable)
+}
+
+// matching returns the versions satisfying c, in the order of versions.
+func matching(versions []versionedPkg, c *constraint) []versionedPkg{
+	var found []versionedPkg
+	for _, v := range versions{
+		if c.Check(v.semver){
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+/*
+	resolveVersion fetches the package list and returns the version of the
+	package name selected by query:
+
+		"latest"			the highest version, pre-releases included
+		"latest stable"		the highest release, 0.x included (also "latest-stable")
+		a constraint		the highest version satisfying it, e.g. "^1.2" or ">=1.0 <2.0"
+
+	The warnings list the versions of name that could not be parsed, they
+	are returned even with an error.
+*/
+func resolveVersion(url, name, query string) (versionedPkg, []versionWarning, error){
+	packages, err := fetchPackageData(url)
+	if err != nil{
+		return versionedPkg{}, nil, err
+	}
+	var named []pkgData
+	for _, p := range packages{
+		if p.Name == name{
+			named = append(named, p)
+		}
+	}
+	versions, warnings := sortByVersion(named)
+
+	var found versionedPkg
+	var ok bool
+	switch strings.Join(strings.Fields(query), " "){
+	case "latest":
+		found, ok = latest(versions)
+	case "latest stable", "latest-stable":
+		found, ok = latestStable(versions)
+	default:
+		c, err := parseConstraint(query)
+		if err != nil{
+			return versionedPkg{}, warnings, err
+		}
+		found, ok = latest(matching(versions, c))
+	}
+	if !ok{
+		return versionedPkg{}, warnings, fmt.Errorf("%w for %s %s", errNoMatchingVersion, name, query)
+	}
+	return found, warnings, nil
+}
@@ -0,0 +1,175 @@
+package pkgquery
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T){
+	for s, expected := range map[string]string{
+		"1.2.3":				"1.2.3",
+		"v1.2.3":				"1.2.3",
+		"1.1":					"1.1.0",
+		"2":					"2.0.0",
+		"1.0.0-rc.1+build.5":	"1.0.0-rc.1+build.5",
+	}{
+		v, err := parseVersion(s)
+		if err != nil{
+			t.Errorf("Expected %q to parse, Got: %v", s, err)
+			continue
+		}
+		if v.String() != expected{
+			t.Errorf("Expected %s, Got: %s", expected, v)
+		}
+	}
+	for _, s := range []string{"", "1.2.3.4", "01.2", "1.x", "1.0.0-", "1.0.0-01", "1.0.0+", "latest"}{
+		if _, err := parseVersion(s); err == nil{
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T){
+	// from the semver spec, in ascending order
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.9.0", "1.10.0", "2.0.0",
+	}
+	for i := 0; i < len(ordered)-1; i++{
+		a, _ := parseVersion(ordered[i])
+		b, _ := parseVersion(ordered[i+1])
+		if a.Compare(b) != -1 || b.Compare(a) != 1{
+			t.Errorf("Expected %s < %s", a, b)
+		}
+	}
+	a, _ := parseVersion("1.0.0+build.1")
+	b, _ := parseVersion("1.0.0+build.2")
+	if a.Compare(b) != 0{
+		t.Errorf("Expected the build metadata to be ignored")
+	}
+}
+
+func TestConstraintCheck(t *testing.T){
+	tests := []struct{
+		constraint	string
+		matches		[]string
+		rejects		[]string
+	}{
+		{"^1.2", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0", "1.5.0-beta"}},
+		{"^0.2", []string{"0.2.0", "0.2.9"}, []string{"0.3.0", "0.1.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"~1.2", []string{"1.2.0", "1.2.7"}, []string{"1.3.0"}},
+		{">=1.0 <2.0", []string{"1.0.0", "1.99.0"}, []string{"0.9.0", "2.0.0", "2.0.0-rc.1"}},
+		{"1.2.x", []string{"1.2.5"}, []string{"1.3.0"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+		{"<=1.2", []string{"1.2.9"}, []string{"1.3.0"}},
+		{"!=1.4.0", []string{"1.4.1"}, []string{"1.4.0"}},
+		{"<1.0 || >=3", []string{"0.5.0", "3.1.0"}, []string{"2.0.0"}},
+		{"*", []string{"0.0.1", "5.0.0"}, []string{"5.0.0-alpha"}},
+		{">=1.0.0-beta <2", []string{"1.0.0-rc.1", "1.5.0"}, []string{"1.5.0-alpha"}},
+	}
+	for _, tt := range tests{
+		c, err := parseConstraint(tt.constraint)
+		if err != nil{
+			t.Fatalf("Expected %q to parse, Got: %v", tt.constraint, err)
+		}
+		for _, s := range tt.matches{
+			v, _ := parseVersion(s)
+			if !c.Check(v){
+				t.Errorf("Expected %s to satisfy %s", s, tt.constraint)
+			}
+		}
+		for _, s := range tt.rejects{
+			v, _ := parseVersion(s)
+			if c.Check(v){
+				t.Errorf("Expected %s not to satisfy %s", s, tt.constraint)
+			}
+		}
+	}
+	for _, s := range []string{"", ">=1 ||", "^x.1", "!=1.2", ">*", "1.x-beta"}{
+		if _, err := parseConstraint(s); err == nil{
+			t.Errorf("Expected an error for the constraint %q", s)
+		}
+	}
+}
+
+func TestSortByVersion(t *testing.T){
+	packages := []pkgData{
+		{Name: "p", Version: "1.10.0"},
+		{Name: "p", Version: "not-a-version"},
+		{Name: "p", Version: "1.9"},
+		{Name: "p", Version: "1.0.0-rc.1"},
+		{Name: "p", Version: "1.0.0"},
+	}
+	versions, warnings := sortByVersion(packages)
+	var got []string
+	for _, v := range versions{
+		got = append(got, v.Version)
+	}
+	if fmt.Sprint(got) != "[1.0.0-rc.1 1.0.0 1.9 1.10.0]"{
+		t.Errorf("Expected [1.0.0-rc.1 1.0.0 1.9 1.10.0], Got: %v", got)
+	}
+	if len(warnings) != 1 || warnings[0].pkg.Version != "not-a-version"{
+		t.Errorf("Expected one warning for not-a-version, Got: %v", warnings)
+	}
+}
+
+func startVersionServer() *httptest.Server{
+	body := `[
+		{"name":"pkg","version":"0.9.0"},
+		{"name":"pkg","version":"1.2.0"},
+		{"name":"pkg","version":"1.10.1"},
+		{"name":"pkg","version":"2.0.0-beta.1"},
+		{"name":"pkg","version":"nightly"},
+		{"name":"young","version":"0.3.0"},
+		{"name":"young","version":"0.4.0-rc.1"},
+		{"name":"other","version":"9.0.0"}
+	]`
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+}
+
+func TestResolveVersion(t *testing.T){
+	ts := startVersionServer()
+	defer ts.Close()
+
+	for query, expected := range map[string]string{
+		"latest":			"2.0.0-beta.1",
+		"latest stable":	"1.10.1",
+		"^1.2":				"1.10.1",
+		"~1.2":				"1.2.0",
+		">=1.0 <2.0":		"1.10.1",
+		"<1":				"0.9.0",
+	}{
+		found, warnings, err := resolveVersion(ts.URL, "pkg", query)
+		if err != nil{
+			t.Errorf("Expected %q to resolve, Got: %v", query, err)
+			continue
+		}
+		if found.Version != expected{
+			t.Errorf("Expected %s for %q, Got: %s", expected, query, found.Version)
+		}
+		// the invalid version is a warning, not an error
+		if len(warnings) != 1 || warnings[0].pkg.Version != "nightly"{
+			t.Errorf("Expected a warning for nightly, Got: %v", warnings)
+		}
+	}
+
+	// a package that never reached 1.0.0 still has stable releases
+	if found, _, err := resolveVersion(ts.URL, "young", "latest stable"); err != nil || found.Version != "0.3.0"{
+		t.Errorf("Expected 0.3.0 for young, Got: %v, %v", found.Version, err)
+	}
+
+	_, _, err := resolveVersion(ts.URL, "pkg", ">=3")
+	if !errors.Is(err, errNoMatchingVersion){
+		t.Errorf("Expected errNoMatchingVersion, Got: %v", err)
+	}
+	if _, _, err := resolveVersion(ts.URL, "pkg", ">>1"); err == nil{
+		t.Errorf("Expected an error for an invalid constraint")
+	}
+}
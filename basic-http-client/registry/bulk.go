@@ -0,0 +1,138 @@
+/*
+	RegisterAll registers the entries of a manifest with a bounded pool of
+	workers: the entries are queued on a channel and Workers goroutines
+	take them one at a time, so at most Workers requests are in flight
+	whatever the size of the release.
+
+	A failed entry does not stop the others, every entry ends up in the
+	report with one of three outcomes:
+
+		registered	the package was created (Register, or Upload when the entry has an artifact)
+		skipped		a duplicate: listed twice in the manifest, or already in the registry (409 Conflict)
+		failed		anything else, with the error; an invalid entry (see ValidateArtifact)
+					fails before any request
+
+	The results are in the order of the manifest, whatever the order the
+	workers finished in.
+
+*/
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type BulkStatus string
+
+const (
+	BulkRegistered	BulkStatus	= "registered"
+	BulkSkipped		BulkStatus	= "skipped"
+	BulkFailed		BulkStatus	= "failed"
+)
+
+type BulkResult struct{
+	Entry		ManifestEntry
+	Status		BulkStatus
+	// ID is the id of the registered package.
+	ID			string
+	// Err is the reason of a failure or of a skip.
+	Err			error
+}
+
+type BulkReport struct{
+	Results		[]BulkResult
+}
+
+// Count returns the number of results with status.
+func (r *BulkReport) Count(status BulkStatus) int{
+	n := 0
+	for _, res := range r.Results{
+		if res.Status == status{
+			n++
+		}
+	}
+	return n
+}
+
+// Failed reports whether at least one entry failed.
+func (r *BulkReport) Failed() bool{
+	return r.Count(BulkFailed) > 0
+}
+
+type BulkOptions struct{
+	// Workers is the number of registrations in flight at a time, 4 by default.
+	Workers		int
+}
+
+var errDuplicateEntry = errors.New("duplicate entry in the manifest")
+
+// RegisterAll registers every entry and reports the outcome of each one, the error of an entry never stops the others.
+// A cancelled ctx fails the entries not registered yet.
+func (c *Client) RegisterAll(ctx context.Context, entries []ManifestEntry, opts BulkOptions) *BulkReport{
+	workers := opts.Workers
+	if workers < 1{
+		workers = 4
+	}
+	report := &BulkReport{Results: make([]BulkResult, len(entries))}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++{
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			for i := range jobs{
+				//each worker writes to its own index, no lock needed
+				report.Results[i] = c.registerEntry(ctx, entries[i])
+			}
+		}()
+	}
+
+	seen := map[string]bool{}
+	for i, e := range entries{
+		//an invalid entry fails before any request, without taking a worker
+		if err := validateEntry(e); err != nil{
+			report.Results[i] = BulkResult{Entry: e, Status: BulkFailed, Err: err}
+			continue
+		}
+		key := e.Name + "@" + e.Version
+		if seen[key]{
+			report.Results[i] = BulkResult{Entry: e, Status: BulkSkipped, Err: errDuplicateEntry}
+			continue
+		}
+		seen[key] = true
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return report
+}
+
+func (c *Client) registerEntry(ctx context.Context, e ManifestEntry) BulkResult{
+	result := BulkResult{Entry: e}
+	id, err := c.registerOne(ctx, e)
+	switch{
+	case err == nil:
+		result.Status, result.ID = BulkRegistered, id
+	case errors.Is(err, ErrConflict):
+		result.Status, result.Err = BulkSkipped, err
+	default:
+		result.Status, result.Err = BulkFailed, err
+	}
+	return result
+}
+
+func (c *Client) registerOne(ctx context.Context, e ManifestEntry) (string, error){
+	if err := ctx.Err(); err != nil{
+		return "", err
+	}
+	if e.Artifact == ""{
+		result, err := c.Register(ctx, PackageData{Name: e.Name, Version: e.Version})
+		return result.ID, err
+	}
+	result, err := c.Upload(ctx, e.artifact())
+	return result.ID, err
+}
@@ -0,0 +1,170 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadManifestFormats(t *testing.T){
+	expected := []ManifestEntry{
+		{Name: "mypackage", Version: "1.0.0", Artifact: "dist/mypackage-1.0.0.tar.gz"},
+		{Name: "mylib", Version: "2.1.0"},
+	}
+	manifests := map[string]string{
+		"json": `[{"name": "mypackage", "version": "1.0.0", "artifact": "dist/mypackage-1.0.0.tar.gz"},
+			{"name": "mylib", "version": "2.1.0"}]`,
+		"csv": "name,version,artifact\nmypackage,1.0.0,dist/mypackage-1.0.0.tar.gz\nmylib,2.1.0\n",
+		"yaml": `# release 1
+packages:
+  - name: mypackage
+    version: "1.0.0"   # quoted
+    artifact: dist/mypackage-1.0.0.tar.gz
+
+  - name: 'mylib'
+    version: 2.1.0
+`,
+	}
+	for format, manifest := range manifests{
+		entries, err := ReadManifest(strings.NewReader(manifest), format)
+		if err != nil{
+			t.Errorf("Expected the %s manifest to be read, Got: %v", format, err)
+			continue
+		}
+		if len(entries) != len(expected){
+			t.Errorf("Expected %d %s entries, Got: %v", len(expected), format, entries)
+			continue
+		}
+		for i := range expected{
+			if entries[i] != expected[i]{
+				t.Errorf("Expected %+v in %s, Got: %+v", expected[i], format, entries[i])
+			}
+		}
+	}
+
+	// the other JSON and YAML shapes
+	for format, manifest := range map[string]string{
+		"json":	`{"packages": [{"name": "mylib", "version": "2.1.0"}]}`,
+		"yml":	"- name: mylib\n  version: 2.1.0\n",
+	}{
+		entries, err := ReadManifest(strings.NewReader(manifest), format)
+		if err != nil || len(entries) != 1 || entries[0] != expected[1]{
+			t.Errorf("Expected mylib 2.1.0 from %s, Got: %v, %v", format, entries, err)
+		}
+	}
+}
+
+func TestReadManifestErrors(t *testing.T){
+	for _, tt := range []struct{ format, manifest string }{
+		{"toml", ""},
+		{"json", `[{"name": "mylib"}]`},
+		{"csv", "package,version\nmylib,1.0\n"},
+		{"yaml", "- name: mylib\n  version: 1.0\n  license: MIT\n"},
+		{"yaml", "- {name: mylib, version: 1.0}\n"},
+		{"yaml", "name: mylib\n"},
+		{"yaml", "- name: mylib\n  version: \"1.0\n"},
+	}{
+		if _, err := ReadManifest(strings.NewReader(tt.manifest), tt.format); err == nil{
+			t.Errorf("Expected an error for the %s manifest %q", tt.format, tt.manifest)
+		}
+	}
+}
+
+func TestLoadManifestRelativeArtifacts(t *testing.T){
+	dir := t.TempDir()
+	path := filepath.Join(dir, "release.csv")
+	if err := os.WriteFile(path, []byte("name,version,artifact\nmypackage,1.0.0,dist/mypackage.tgz\n"), 0644); err != nil{
+		t.Fatal(err)
+	}
+	entries, err := LoadManifest(path)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if entries[0].Artifact != filepath.Join(dir, "dist", "mypackage.tgz"){
+		t.Errorf("Expected the artifact path relative to the manifest, Got: %s", entries[0].Artifact)
+	}
+}
+
+func TestRegisterAllReport(t *testing.T){
+	ts, c := startTestRegistry(t)
+	defer ts.Close()
+	ctx := context.Background()
+
+	if _, err := c.Register(ctx, PackageData{Name: "existing", Version: "1.0.0"}); err != nil{
+		t.Fatal(err)
+	}
+	artifact := filepath.Join(t.TempDir(), "mypackage-1.0.0.tar.gz")
+	if err := os.WriteFile(artifact, []byte("data"), 0644); err != nil{
+		t.Fatal(err)
+	}
+
+	entries := []ManifestEntry{
+		{Name: "mypackage", Version: "1.0.0", Artifact: artifact},
+		{Name: "mylib", Version: "2.1.0"},
+		{Name: "existing", Version: "1.0.0"},
+		{Name: "mylib", Version: "2.1.0"},
+		{Name: "mytool", Version: "0.3.0", Artifact: filepath.Join(t.TempDir(), "missing.tgz")},
+		{Name: "other", Version: "1.0.0"},
+		{Name: "my tool", Version: "latest"},
+	}
+	report := c.RegisterAll(ctx, entries, BulkOptions{Workers: 2})
+
+	expected := []BulkStatus{BulkRegistered, BulkRegistered, BulkSkipped, BulkSkipped, BulkFailed, BulkRegistered, BulkFailed}
+	for i, res := range report.Results{
+		if res.Entry != entries[i] || res.Status != expected[i]{
+			t.Errorf("Expected %s for %+v, Got: %s (%v)", expected[i], entries[i], res.Status, res.Err)
+		}
+	}
+	if report.Results[0].ID != "mypackage-1.0.0"{
+		t.Errorf("Expected the id mypackage-1.0.0, Got: %s", report.Results[0].ID)
+	}
+	if !errors.Is(report.Results[2].Err, ErrConflict) || !errors.Is(report.Results[3].Err, errDuplicateEntry){
+		t.Errorf("Expected a conflict and a duplicate, Got: %v, %v", report.Results[2].Err, report.Results[3].Err)
+	}
+	var verrs ValidationErrors
+	if !errors.As(report.Results[6].Err, &verrs) || len(verrs) != 2{
+		t.Errorf("Expected the invalid entry to fail its validation, Got: %v", report.Results[6].Err)
+	}
+	if !report.Failed() || report.Count(BulkRegistered) != 3{
+		t.Errorf("Expected 3 registered and a failure, Got: %d, %v", report.Count(BulkRegistered), report.Failed())
+	}
+}
+
+func TestRegisterAllBoundedWorkers(t *testing.T){
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	reg := newTestRegistry()
+	ts, c := startTestRegistry(t)
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight{
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 *time.Millisecond)
+		reg.ServeHTTP(w, r)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	})
+	defer ts.Close()
+
+	var entries []ManifestEntry
+	for _, v := range []string{"1.0.0", "1.0.1", "1.0.2", "1.0.3", "1.0.4", "1.0.5", "1.0.6", "1.0.7", "1.0.8", "1.0.9"}{
+		entries = append(entries, ManifestEntry{Name: "mypackage", Version: v})
+	}
+	report := c.RegisterAll(context.Background(), entries, BulkOptions{Workers: 3})
+	if report.Count(BulkRegistered) != len(entries){
+		t.Errorf("Expected %d registered, Got: %d", len(entries), report.Count(BulkRegistered))
+	}
+	if maxInFlight > 3{
+		t.Errorf("Expected at most 3 requests in flight, Got: %d", maxInFlight)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+	pkgquery, pkgRegister and multipartData each talk to the package
+	registry with their own unexported pkgData and with http.Get/http.Post,
+	that is with the DefaultClient: no time-out, no way to add a middleware.
+
+	Client gathers them behind one exported API:
+
+		GET		/packages			List
+		GET		/packages/{id}		Get
+		POST	/packages			Register, JSON metadata
+		POST	/uploads			Upload, multipart artifact
+		PUT		/packages/{id}		Update
+		DELETE	/packages/{id}		Delete
+
+	The paths are relative to the base URL (e.g. https://registry.example.com/api).
+	The *http.Client is injected, so the middlewares and transports of
+	advanced-http-client can be used with it.
+
+*/
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Client struct{
+	baseURL		*url.URL
+	httpClient	*http.Client
+	decoders	map[string]Decoder
+	accept		string
+}
+
+// NewClient returns a client of the registry at baseURL. A nil httpClient is replaced by one with a 30s time-out.
+func NewClient(baseURL string, httpClient *http.Client) (*Client, error){
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil{
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https"{
+		return nil, fmt.Errorf("registry: base URL should be http or https, Got: %q", baseURL)
+	}
+	if httpClient == nil{
+		httpClient = &http.Client{Timeout: 30 *time.Second}
+	}
+	decoders := defaultDecoders()
+	return &Client{baseURL: u, httpClient: httpClient, decoders: decoders, accept: acceptHeader(decoders)}, nil
+}
+
+// endpoint returns the URL of path (e.g. "/packages") under the base URL.
+func (c *Client) endpoint(path string) string{
+	return c.baseURL.String() + path
+}
+
+func packagePath(id string) string{
+	return "/packages/" + url.PathEscape(id)
+}
+
+func (c *Client) newJSONRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error){
+	if body == nil{
+		return http.NewRequestWithContext(ctx, method, c.endpoint(path), nil)
+	}
+	b, err := json.Marshal(body)
+	if err != nil{
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint(path), bytes.NewReader(b))
+	if err != nil{
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// send sends req and returns the headers and the body of a 2xx response.
+// A non-2xx status is returned as a *ProblemError.
+func (c *Client) send(req *http.Request) (http.Header, []byte, error){
+	req.Header.Set("Accept", c.accept)
+	resp, err := c.httpClient.Do(req)
+	if err != nil{
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil{
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299{
+		return nil, nil, DecodeProblem(resp, data)
+	}
+	return resp.Header, data, nil
+}
+
+// do sends req and decodes the response into out (unless out is nil) according to its Content-Type.
+func (c *Client) do(req *http.Request, out interface{}) error{
+	header, data, err := c.send(req)
+	if err != nil{
+		return err
+	}
+	if out == nil || len(data) == 0{
+		return nil
+	}
+	decode, _, err := c.decoderFor(header.Get("Content-Type"))
+	if err != nil{
+		return err
+	}
+	if err := decode(data, out); err != nil{
+		return fmt.Errorf("registry: decoding the response of %s %s: %w", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
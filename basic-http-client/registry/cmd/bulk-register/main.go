@@ -0,0 +1,104 @@
+/*
+	bulk-register registers the packages of a release manifest (JSON, YAML
+	or CSV, see registry.LoadManifest) and prints what happened to each one:
+
+		bulk-register -registry https://registry.example.com/api -workers 8 release.yaml
+
+		registered	mypackage 1.0.0		mypackage-1.0.0
+		skipped		mylib 2.1.0			registry: 409 Conflict: package already registered
+		failed		mytool 0.3.0		invalid package: path: stat dist/mytool.tgz: no such file or directory
+
+		1 registered, 1 skipped, 1 failed
+
+	The exit status is 1 when an entry failed (skipped duplicates are not
+	failures) and 2 when the manifest could not be read.
+
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Praveen005/Go-http-client/tree/main/basic-http-client/registry"
+)
+
+type jsonResult struct{
+	Name		string		`json:"name"`
+	Version		string		`json:"version"`
+	Artifact	string		`json:"artifact,omitempty"`
+	Status		string		`json:"status"`
+	ID			string		`json:"id,omitempty"`
+	Reason		string		`json:"reason,omitempty"`
+}
+
+func writeText(w io.Writer, report *registry.BulkReport){
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, res := range report.Results{
+		detail := res.ID
+		if res.Err != nil{
+			detail = res.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s %s\t%s\n", res.Status, res.Entry.Name, res.Entry.Version, detail)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d registered, %d skipped, %d failed\n",
+		report.Count(registry.BulkRegistered), report.Count(registry.BulkSkipped), report.Count(registry.BulkFailed))
+}
+
+func writeJSON(w io.Writer, report *registry.BulkReport) error{
+	results := make([]jsonResult, len(report.Results))
+	for i, res := range report.Results{
+		results[i] = jsonResult{Name: res.Entry.Name, Version: res.Entry.Version, Artifact: res.Entry.Artifact, Status: string(res.Status), ID: res.ID}
+		if res.Err != nil{
+			results[i].Reason = res.Err.Error()
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+func main(){
+	registryURL := flag.String("registry", "", "base URL of the package registry")
+	workers := flag.Int("workers", 4, "number of packages registered at the same time")
+	timeout := flag.Duration("timeout", 30 *time.Second, "time-out of each request")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	if *registryURL == "" || flag.NArg() != 1 || *workers < 1{
+		fmt.Fprintln(os.Stderr, "Usage: bulk-register -registry url [-workers n] [-timeout d] [-json] manifest.{json,yaml,csv}")
+		os.Exit(2)
+	}
+	entries, err := registry.LoadManifest(flag.Arg(0))
+	if err != nil{
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+	client, err := registry.NewClient(*registryURL, &http.Client{Timeout: *timeout})
+	if err != nil{
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
+	report := client.RegisterAll(context.Background(), entries, registry.BulkOptions{Workers: *workers})
+	if *asJSON{
+		if err := writeJSON(os.Stdout, report); err != nil{
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+	}else{
+		writeText(os.Stdout, report)
+	}
+	if report.Failed(){
+		os.Exit(1)
+	}
+}
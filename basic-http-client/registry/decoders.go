@@ -0,0 +1,266 @@
+/*
+	fetchPackageData compared Content-Type with "application/json", so a
+	server answering "application/json; charset=utf-8" got an empty list
+	and no error. A media type has parameters and is case insensitive,
+	mime.ParseMediaType takes care of that.
+
+	The client decodes a response with the decoder registered for its media
+	type, and sends the registered types in the Accept header:
+
+		application/json		encoding/json, also used for the +json vendor types
+								(application/vnd.registry.v2+json)
+		application/x-ndjson	one JSON value per line, appended to a slice
+		application/xml			encoding/xml, also text/xml and the +xml types. Decoding
+								into a slice takes each child of the root element
+		text/csv				a header row naming the fields (json tag names),
+								then one record per row, into a slice of structs
+
+	Other types can be added with RegisterDecoder. A response with any
+	other type fails with an *UnsupportedMediaTypeError instead of
+	returning nothing.
+
+*/
+
+package registry
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Decoder decodes a response body into v, a pointer.
+type Decoder func(data []byte, v interface{}) error
+
+// UnsupportedMediaTypeError is returned for a response with no decoder for its Content-Type.
+type UnsupportedMediaTypeError struct{
+	// MediaType is the media type of the response, without parameters, empty if there was none.
+	MediaType	string
+	Supported	[]string
+}
+
+func (e *UnsupportedMediaTypeError) Error() string{
+	if e.MediaType == ""{
+		return "registry: response without Content-Type"
+	}
+	return fmt.Sprintf("registry: unsupported media type %q, expected one of %s", e.MediaType, strings.Join(e.Supported, ", "))
+}
+
+func defaultDecoders() map[string]Decoder{
+	return map[string]Decoder{
+		"application/json":		json.Unmarshal,
+		"application/x-ndjson":	decodeNDJSON,
+		"application/xml":		decodeXML,
+		"text/xml":				decodeXML,
+		"text/csv":				decodeCSV,
+	}
+}
+
+// RegisterDecoder sets the decoder of mediaType (e.g. "application/yaml"), replacing the default one if any.
+// It should be called before the client is used.
+func (c *Client) RegisterDecoder(mediaType string, d Decoder){
+	c.decoders[strings.ToLower(mediaType)] = d
+	c.accept = acceptHeader(c.decoders)
+}
+
+// acceptHeader lists the media types with a decoder, JSON first.
+func acceptHeader(decoders map[string]Decoder) string{
+	var others []string
+	for mediaType := range decoders{
+		if mediaType != "application/json"{
+			others = append(others, mediaType)
+		}
+	}
+	sort.Strings(others)
+	accept := []string{"application/json"}
+	for _, mediaType := range others{
+		accept = append(accept, mediaType+";q=0.9")
+	}
+	return strings.Join(accept, ", ")
+}
+
+// decoderFor returns the decoder of contentType, falling back on the structured syntax suffix (+json, +xml).
+func (c *Client) decoderFor(contentType string) (Decoder, string, error){
+	supported := func() []string{
+		var s []string
+		for mediaType := range c.decoders{
+			s = append(s, mediaType)
+		}
+		sort.Strings(s)
+		return s
+	}
+	if contentType == ""{
+		return nil, "", &UnsupportedMediaTypeError{Supported: supported()}
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil{
+		return nil, "", fmt.Errorf("registry: invalid Content-Type %q: %w", contentType, err)
+	}
+	if d, ok := c.decoders[mediaType]; ok{
+		return d, mediaType, nil
+	}
+	if i := strings.LastIndex(mediaType, "+"); i >= 0{
+		if d, ok := c.decoders["application/"+mediaType[i+1:]]; ok{
+			return d, mediaType, nil
+		}
+	}
+	return nil, mediaType, &UnsupportedMediaTypeError{MediaType: mediaType, Supported: supported()}
+}
+
+// isJSON reports whether mediaType is JSON or a +json type.
+func isJSON(mediaType string) bool{
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// sliceOf returns the slice v points to, if it does.
+func sliceOf(v interface{}) (reflect.Value, bool){
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Slice{
+		return reflect.Value{}, false
+	}
+	return rv.Elem(), true
+}
+
+func decodeNDJSON(data []byte, v interface{}) error{
+	dec := json.NewDecoder(bytes.NewReader(data))
+	slice, ok := sliceOf(v)
+	if !ok{
+		// a single value
+		return dec.Decode(v)
+	}
+	for{
+		elem := reflect.New(slice.Type().Elem())
+		err := dec.Decode(elem.Interface())
+		if err == io.EOF{
+			return nil
+		}
+		if err != nil{
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+}
+
+func decodeXML(data []byte, v interface{}) error{
+	slice, ok := sliceOf(v)
+	if !ok{
+		return xml.Unmarshal(data, v)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	for{
+		tok, err := dec.Token()
+		if err == io.EOF{
+			return nil
+		}
+		if err != nil{
+			return err
+		}
+		switch t := tok.(type){
+		case xml.StartElement:
+			if depth == 0{
+				// the root element holds the list
+				depth++
+				continue
+			}
+			elem := reflect.New(slice.Type().Elem())
+			if err := dec.DecodeElement(elem.Interface(), &t); err != nil{
+				return err
+			}
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// decodeCSV decodes the records into a slice of structs, the header naming the fields by their json tag (or name).
+func decodeCSV(data []byte, v interface{}) error{
+	slice, ok := sliceOf(v)
+	if !ok || slice.Type().Elem().Kind() != reflect.Struct{
+		return errors.New("registry: CSV can only be decoded into a slice of structs")
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil{
+		return err
+	}
+	if len(records) == 0{
+		return nil
+	}
+
+	elemType := slice.Type().Elem()
+	fields := map[string]int{}
+	for i := 0; i < elemType.NumField(); i++{
+		f := elemType.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-"{
+			continue
+		}
+		if name == ""{
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = i
+	}
+
+	header := records[0]
+	for line, record := range records[1:]{
+		elem := reflect.New(elemType).Elem()
+		for col, value := range record{
+			i, ok := fields[strings.ToLower(strings.TrimSpace(header[col]))]
+			if !ok{
+				continue
+			}
+			if err := setField(elem.Field(i), value); err != nil{
+				return fmt.Errorf("registry: CSV line %d, column %s: %w", line+2, header[col], err)
+			}
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+	return nil
+}
+
+func setField(f reflect.Value, value string) error{
+	if value == ""{
+		return nil
+	}
+	switch f.Kind(){
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil{
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil{
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil{
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil{
+			return err
+		}
+		f.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// startContentServer answers every request with body and contentType, and records the Accept header.
+func startContentServer(contentType, body string, accept *string) *httptest.Server{
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*accept = r.Header.Get("Accept")
+		if contentType != ""{
+			w.Header().Set("Content-Type", contentType)
+		}else{
+			// keep net/http from sniffing one
+			w.Header()["Content-Type"] = nil
+		}
+		io.WriteString(w, body)
+	}))
+	return ts
+}
+
+func TestDecoders(t *testing.T){
+	for _, tc := range []struct{
+		contentType	string
+		body		string
+	}{
+		{"application/json; charset=utf-8", `[{"id":"a-1","name":"a","version":"1"},{"id":"b-2","name":"b","version":"2","size":4}]`},
+		{"Application/JSON", `[{"id":"a-1","name":"a","version":"1"},{"id":"b-2","name":"b","version":"2","size":4}]`},
+		{"application/vnd.registry.v2+json", `[{"id":"a-1","name":"a","version":"1"},{"id":"b-2","name":"b","version":"2","size":4}]`},
+		{"application/x-ndjson", "{\"id\":\"a-1\",\"name\":\"a\",\"version\":\"1\"}\n{\"id\":\"b-2\",\"name\":\"b\",\"version\":\"2\",\"size\":4}\n"},
+		{"application/xml", `<packages><package><id>a-1</id><name>a</name><version>1</version></package><package><id>b-2</id><name>b</name><version>2</version><size>4</size></package></packages>`},
+		{"application/atom+xml", `<packages><package><id>a-1</id><name>a</name><version>1</version></package><package><id>b-2</id><name>b</name><version>2</version><size>4</size></package></packages>`},
+		{"text/csv; header=present", "id,name,version,size,unknown\na-1,a,1,,x\nb-2,b,2,4,y\n"},
+	}{
+		var accept string
+		ts := startContentServer(tc.contentType, tc.body, &accept)
+		c, _ := NewClient(ts.URL, ts.Client())
+		packages, err := c.List(context.Background())
+		ts.Close()
+		if err != nil{
+			t.Errorf("%s: %v", tc.contentType, err)
+			continue
+		}
+		if len(packages) != 2 || packages[0].ID != "a-1" || packages[1].Version != "2" || packages[1].Size != 4{
+			t.Errorf("%s: Expected a-1 and b-2 (4 bytes), Got: %+v", tc.contentType, packages)
+		}
+		if !strings.HasPrefix(accept, "application/json, ") || !strings.Contains(accept, "text/csv;q=0.9"){
+			t.Errorf("Expected the Accept header to list the decoders, Got: %s", accept)
+		}
+	}
+}
+
+func TestUnsupportedMediaType(t *testing.T){
+	for contentType, expected := range map[string]string{
+		"text/html; charset=utf-8":	"text/html",
+		"":							"",
+	}{
+		var accept string
+		ts := startContentServer(contentType, "<html>oops</html>", &accept)
+		c, _ := NewClient(ts.URL, ts.Client())
+		_, err := c.Get(context.Background(), "a-1")
+		ts.Close()
+
+		var mediaErr *UnsupportedMediaTypeError
+		if !errors.As(err, &mediaErr){
+			t.Errorf("Expected an *UnsupportedMediaTypeError for %q, Got: %v", contentType, err)
+			continue
+		}
+		if mediaErr.MediaType != expected{
+			t.Errorf("Expected media type %q, Got: %q", expected, mediaErr.MediaType)
+		}
+	}
+}
+
+func TestRegisterDecoder(t *testing.T){
+	var accept string
+	ts := startContentServer("text/plain", "a-1 a 1", &accept)
+	defer ts.Close()
+	c, _ := NewClient(ts.URL, ts.Client())
+	c.RegisterDecoder("Text/Plain", func(data []byte, v interface{}) error{
+		fields := strings.Fields(string(data))
+		*v.(*Package) = Package{ID: fields[0], Name: fields[1], Version: fields[2]}
+		return nil
+	})
+
+	p, err := c.Get(context.Background(), "a-1")
+	if err != nil{
+		t.Fatal(err)
+	}
+	if p.Name != "a" || !strings.Contains(accept, "text/plain;q=0.9"){
+		t.Errorf("Expected the custom decoder to be used and announced, Got: %+v, Accept: %s", p, accept)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+	A release manifest lists the packages to register, one entry per
+	package with its name, version and, optionally, the path of the
+	artifact to upload (relative paths are relative to the manifest).
+	The same list can be written in three formats:
+
+	JSON, an array or an object with a "packages" array:
+
+		[{"name": "mypackage", "version": "1.0.0", "artifact": "dist/mypackage-1.0.0.tar.gz"}]
+
+	CSV, with a header row, the artifact column is optional:
+
+		name,version,artifact
+		mypackage,1.0.0,dist/mypackage-1.0.0.tar.gz
+
+	YAML, a list of mappings, at the top level or under "packages":
+
+		packages:
+		  - name: mypackage
+		    version: 1.0.0		# a comment
+		    artifact: "dist/mypackage-1.0.0.tar.gz"
+
+	Only this block subset of YAML is read (no flow style, anchors or
+	multi-line strings), which is enough for a manifest and keeps the
+	module free of dependencies.
+
+*/
+
+package registry
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type ManifestEntry struct{
+	Name		string		`json:"name"`
+	Version		string		`json:"version"`
+	// Artifact is the path of the file to upload, empty to register the metadata only.
+	Artifact	string		`json:"artifact,omitempty"`
+}
+
+// LoadManifest reads the manifest at path, the format is chosen by the extension (.json, .yaml/.yml, .csv).
+// The relative artifact paths are made relative to the directory of the manifest.
+func LoadManifest(path string) ([]ManifestEntry, error){
+	f, err := os.Open(path)
+	if err != nil{
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := ReadManifest(f, strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."))
+	if err != nil{
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	for i, e := range entries{
+		if e.Artifact != "" && !filepath.IsAbs(e.Artifact){
+			entries[i].Artifact = filepath.Join(dir, e.Artifact)
+		}
+	}
+	return entries, nil
+}
+
+// ReadManifest reads a manifest in format "json", "yaml" (or "yml") or "csv".
+func ReadManifest(r io.Reader, format string) ([]ManifestEntry, error){
+	var entries []ManifestEntry
+	var err error
+	switch format{
+	case "json":
+		entries, err = readJSONManifest(r)
+	case "yaml", "yml":
+		entries, err = readYAMLManifest(r)
+	case "csv":
+		entries, err = readCSVManifest(r)
+	default:
+		return nil, fmt.Errorf("unknown manifest format %q, expected json, yaml or csv", format)
+	}
+	if err != nil{
+		return nil, err
+	}
+	for i, e := range entries{
+		if e.Name == "" || e.Version == ""{
+			return nil, fmt.Errorf("entry %d: name and version are required", i+1)
+		}
+	}
+	return entries, nil
+}
+
+func readJSONManifest(r io.Reader) ([]ManifestEntry, error){
+	data, err := io.ReadAll(r)
+	if err != nil{
+		return nil, err
+	}
+	var entries []ManifestEntry
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{'{
+		var doc struct{
+			Packages	[]ManifestEntry	`json:"packages"`
+		}
+		err = json.Unmarshal(data, &doc)
+		entries = doc.Packages
+	}else{
+		err = json.Unmarshal(data, &entries)
+	}
+	return entries, err
+}
+
+func readCSVManifest(r io.Reader) ([]ManifestEntry, error){
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	// the artifact column may be missing
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil{
+		return nil, err
+	}
+	if len(records) == 0{
+		return nil, nil
+	}
+	columns := map[string]int{}
+	for i, name := range records[0]{
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["name"]; !ok{
+		return nil, fmt.Errorf("the header should have a name column, Got: %v", records[0])
+	}
+	if _, ok := columns["version"]; !ok{
+		return nil, fmt.Errorf("the header should have a version column, Got: %v", records[0])
+	}
+	field := func(record []string, column string) string{
+		i, ok := columns[column]
+		if !ok || i >= len(record){
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var entries []ManifestEntry
+	for _, record := range records[1:]{
+		entries = append(entries, ManifestEntry{Name: field(record, "name"), Version: field(record, "version"), Artifact: field(record, "artifact")})
+	}
+	return entries, nil
+}
+
+func readYAMLManifest(r io.Reader) ([]ManifestEntry, error){
+	var entries []ManifestEntry
+	var current *ManifestEntry
+	// the indentation of the "- " items, -1 until the first one
+	itemIndent := -1
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++{
+		line := stripYAMLComment(scanner.Text())
+		if strings.TrimSpace(line) == "" || line == "---"{
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if strings.ContainsRune(line[:indent+1], '\t'){
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n)
+		}
+		text := line[indent:]
+
+		switch{
+		case text == "packages:" && indent == 0 && itemIndent < 0:
+			continue
+		case text == "-" || strings.HasPrefix(text, "- "):
+			if itemIndent >= 0 && indent != itemIndent{
+				return nil, fmt.Errorf("line %d: unexpected indentation", n)
+			}
+			itemIndent = indent
+			entries = append(entries, ManifestEntry{})
+			current = &entries[len(entries)-1]
+			text = strings.TrimSpace(strings.TrimPrefix(text, "-"))
+			if text == ""{
+				continue
+			}
+		case current == nil || indent <= itemIndent:
+			return nil, fmt.Errorf("line %d: expected a list item, Got: %q", n, text)
+		}
+
+		key, value, err := parseYAMLPair(text)
+		if err != nil{
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch key{
+		case "name":
+			current.Name = value
+		case "version":
+			current.Version = value
+		case "artifact":
+			current.Artifact = value
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q", n, key)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// stripYAMLComment removes a # comment, unless it is inside quotes, and the trailing spaces.
+func stripYAMLComment(line string) string{
+	var quote rune
+	for i, r := range line{
+		switch{
+		case quote != 0:
+			if r == quote{
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+// parseYAMLPair parses "key: value", the value may be quoted.
+func parseYAMLPair(text string) (string, string, error){
+	key, value, ok := strings.Cut(text, ":")
+	if !ok || key == "" || (value != "" && value[0] != ' '){
+		return "", "", fmt.Errorf("expected key: value, Got: %q", text)
+	}
+	value = strings.TrimSpace(value)
+	switch{
+	case value == "":
+		return key, "", nil
+	case value[0] == '{' || value[0] == '[' || value[0] == '|' || value[0] == '>' || value[0] == '&' || value[0] == '*':
+		return "", "", fmt.Errorf("unsupported YAML value %q", value)
+	case value[0] == '"':
+		unquoted, err := strconv.Unquote(value)
+		if err != nil{
+			return "", "", fmt.Errorf("bad quoted value %s", value)
+		}
+		return key, unquoted, nil
+	case value[0] == '\'':
+		if len(value) < 2 || value[len(value)-1] != '\''{
+			return "", "", fmt.Errorf("bad quoted value %s", value)
+		}
+		// '' is an escaped quote in single-quoted YAML
+		return key, strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return key, value, nil
+}
@@ -0,0 +1,40 @@
+package registry
+
+import "io"
+
+// Package is a package as stored by the registry.
+type Package struct{
+	ID			string		`json:"id" xml:"id"`
+	Name		string		`json:"name" xml:"name"`
+	Version		string		`json:"version" xml:"version"`
+	// Filename and Size describe the uploaded artifact, if any.
+	Filename	string		`json:"filename,omitempty" xml:"filename,omitempty"`
+	Size		int64		`json:"size,omitempty" xml:"size,omitempty"`
+}
+
+// PackageData is the metadata sent to register or update a package (pkgRegister).
+type PackageData struct{
+	Name		string		`json:"name"`
+	Version		string		`json:"version"`
+}
+
+// Artifact is a package file uploaded as a multipart message (multipartData).
+type Artifact struct{
+	Name		string
+	Version		string
+	Filename	string
+	// Bytes points to the content of the file, e.g. an opened *os.File.
+	Bytes		io.Reader
+	// Path is the file to upload, used instead of Bytes.
+	Path		string
+}
+
+type RegisterResult struct{
+	ID			string		`json:"id"`
+}
+
+type UploadResult struct{
+	ID			string		`json:"id"`
+	Filename	string		`json:"filename"`
+	Size		int64		`json:"size"`
+}
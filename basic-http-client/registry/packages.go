@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+)
+
+// List returns all the packages (pkgquery), following the pages if the registry paginates.
+func (c *Client) List(ctx context.Context) ([]Package, error){
+	packages := []Package{}
+	it := c.Packages(ctx, nil)
+	for it.Next(){
+		packages = append(packages, it.Package())
+	}
+	return packages, it.Err()
+}
+
+func (c *Client) Get(ctx context.Context, id string) (Package, error){
+	var p Package
+	req, err := c.newJSONRequest(ctx, http.MethodGet, packagePath(id), nil)
+	if err != nil{
+		return p, err
+	}
+	err = c.do(req, &p)
+	return p, err
+}
+
+// Register registers the metadata of a package (pkgRegister).
+// Invalid metadata is returned as a ValidationErrors, without sending any request.
+func (c *Client) Register(ctx context.Context, data PackageData) (RegisterResult, error){
+	var result RegisterResult
+	if err := ValidatePackageData(data); err != nil{
+		return result, err
+	}
+	req, err := c.newJSONRequest(ctx, http.MethodPost, "/packages", data)
+	if err != nil{
+		return result, err
+	}
+	err = c.do(req, &result)
+	return result, err
+}
+
+// Upload registers a package with its artifact, as a multipart message (multipartData).
+// An invalid upload is returned as a ValidationErrors, without sending any request.
+func (c *Client) Upload(ctx context.Context, a Artifact) (UploadResult, error){
+	var result UploadResult
+	if err := ValidateArtifact(a); err != nil{
+		return result, err
+	}
+	//the message is streamed to the registry as it is written, see upload.go
+	req, done, err := NewUploadRequest(ctx, c.endpoint("/uploads"), a)
+	if err != nil{
+		return result, err
+	}
+	err = c.do(req, &result)
+	//the error of the file (or its size) explains the failure better than the transport
+	if werr := done(); werr != nil{
+		return result, werr
+	}
+	return result, err
+}
+
+// Update replaces the metadata of the package id and returns the package as stored.
+func (c *Client) Update(ctx context.Context, id string, data PackageData) (Package, error){
+	var p Package
+	req, err := c.newJSONRequest(ctx, http.MethodPut, packagePath(id), data)
+	if err != nil{
+		return p, err
+	}
+	err = c.do(req, &p)
+	return p, err
+}
+
+func (c *Client) Delete(ctx context.Context, id string) error{
+	req, err := c.newJSONRequest(ctx, http.MethodDelete, packagePath(id), nil)
+	if err != nil{
+		return err
+	}
+	return c.do(req, nil)
+}
@@ -0,0 +1,248 @@
+/*
+	fetchPackageData (pkgquery) expects the whole list in one JSON array.
+	A registry with thousands of packages sends it a page at a time, and
+	says where the next page is in one of these ways:
+
+		1. A Link header (RFC 8288), the body being a JSON array:
+
+			Link: <https://registry.example.com/packages?page=3>; rel="next"
+
+		2. A JSON envelope with a cursor, sent back as ?cursor= on the same URL:
+
+			{"items": [...], "next_cursor": "b2Zmc2V0PTUw"}
+
+		3. A JSON envelope with offset/limit/total, the next page being ?offset=offset+len(items):
+
+			{"items": [...], "offset": 100, "limit": 50, "total": 1234}
+
+		An envelope may also give the URL of the next page in "next".
+
+	PackageIterator reads the pages lazily: a page is requested only when
+	Next has consumed the previous one, like bufio.Scanner or sql.Rows:
+
+		it := c.Packages(ctx, nil)
+		for it.Next(){
+			p := it.Package()
+			...
+		}
+		if err := it.Err(); err != nil{
+			...
+		}
+
+	The envelopes are JSON, a page in another format (NDJSON, CSV...) can
+	only point to the next one with a Link header.
+
+	The iteration stops as soon as ctx is done, Err then returns ctx.Err().
+	It also stops with an error when a next link points to a page already
+	fetched (A -> B -> A), a broken server would otherwise be followed
+	forever.
+
+*/
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type ListOptions struct{
+	// PageSize is sent as ?limit=, the server decides when zero.
+	PageSize	int
+}
+
+// envelope is a page sent as a JSON object.
+type envelope struct{
+	Items		[]Package	`json:"items"`
+	Next		string		`json:"next"`
+	NextCursor	string		`json:"next_cursor"`
+	Offset		*int		`json:"offset"`
+	Total		*int		`json:"total"`
+}
+
+type PackageIterator struct{
+	c		*Client
+	ctx		context.Context
+	// next is the URL of the next page, empty after the last one.
+	next	string
+	page	[]Package
+	current	Package
+	err		error
+	// visited holds the URLs of the pages fetched so far.
+	visited	map[string]bool
+}
+
+// Packages returns an iterator over all the packages, reading them a page at a time.
+func (c *Client) Packages(ctx context.Context, opts *ListOptions) *PackageIterator{
+	first := c.endpoint("/packages")
+	if opts != nil && opts.PageSize > 0{
+		first += "?limit=" + strconv.Itoa(opts.PageSize)
+	}
+	return &PackageIterator{c: c, ctx: ctx, next: first, visited: map[string]bool{}}
+}
+
+// Next advances to the next package, fetching the next page if needed.
+// It returns false at the end of the list or on error, see Err.
+func (it *PackageIterator) Next() bool{
+	if it.err != nil{
+		return false
+	}
+	for len(it.page) == 0{
+		if err := it.ctx.Err(); err != nil{
+			it.err = err
+			return false
+		}
+		if it.next == ""{
+			return false
+		}
+		if err := it.fetch(); err != nil{
+			it.err = err
+			return false
+		}
+	}
+	if err := it.ctx.Err(); err != nil{
+		it.err = err
+		return false
+	}
+	it.current = it.page[0]
+	it.page = it.page[1:]
+	return true
+}
+
+// Package returns the package Next advanced to.
+func (it *PackageIterator) Package() Package{
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, nil at the end of the list.
+func (it *PackageIterator) Err() error{
+	return it.err
+}
+
+func (it *PackageIterator) fetch() error{
+	pageURL := it.next
+	it.visited[pageURL] = true
+	req, err := http.NewRequestWithContext(it.ctx, http.MethodGet, pageURL, nil)
+	if err != nil{
+		return err
+	}
+	header, data, err := it.c.send(req)
+	if err != nil{
+		return err
+	}
+
+	it.next = ""
+	decode, mediaType, err := it.c.decoderFor(header.Get("Content-Type"))
+	if err != nil{
+		return err
+	}
+	data = bytes.TrimSpace(data)
+	if isJSON(mediaType) && len(data) > 0 && data[0] == '{'{
+		var env envelope
+		if err := json.Unmarshal(data, &env); err != nil{
+			return fmt.Errorf("registry: decoding the page %s: %w", pageURL, err)
+		}
+		it.page = env.Items
+		switch{
+		case env.Next != "":
+			it.next, err = resolve(req.URL, env.Next)
+		case env.NextCursor != "":
+			it.next = withQuery(req.URL, "cursor", env.NextCursor)
+		case env.Offset != nil && env.Total != nil && len(env.Items) > 0 && *env.Offset+len(env.Items) < *env.Total:
+			it.next = withQuery(req.URL, "offset", strconv.Itoa(*env.Offset+len(env.Items)))
+		}
+		if err != nil{
+			return err
+		}
+	}else if err := decode(data, &it.page); err != nil{
+		return fmt.Errorf("registry: decoding the page %s: %w", pageURL, err)
+	}
+
+	// the Link header wins over the body
+	if link, ok := parseLinkHeader(header.Values("Link"))["next"]; ok{
+		if it.next, err = resolve(req.URL, link); err != nil{
+			return err
+		}
+	}
+	if it.visited[it.next]{
+		return fmt.Errorf("registry: the page %s links back to %s, already fetched", pageURL, it.next)
+	}
+	// a server sending an empty page with a next link would keep us busy forever
+	if len(it.page) == 0{
+		it.next = ""
+	}
+	return nil
+}
+
+func resolve(base *url.URL, ref string) (string, error){
+	u, err := base.Parse(ref)
+	if err != nil{
+		return "", fmt.Errorf("registry: invalid next page URL %q: %w", ref, err)
+	}
+	return u.String(), nil
+}
+
+func withQuery(u *url.URL, key, value string) string{
+	next := *u
+	q := next.Query()
+	q.Set(key, value)
+	next.RawQuery = q.Encode()
+	return next.String()
+}
+
+// parseLinkHeader returns the target of each relation of the Link header values (RFC 8288).
+func parseLinkHeader(values []string) map[string]string{
+	links := map[string]string{}
+	for _, v := range values{
+		for _, link := range splitLinks(v){
+			link = strings.TrimSpace(link)
+			if !strings.HasPrefix(link, "<"){
+				continue
+			}
+			end := strings.Index(link, ">")
+			if end < 0{
+				continue
+			}
+			target := link[1:end]
+			for _, param := range strings.Split(link[end+1:], ";"){
+				name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel"){
+					continue
+				}
+				// rel may hold several space separated relations
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)){
+					rel = strings.ToLower(rel)
+					if _, seen := links[rel]; !seen{
+						links[rel] = target
+					}
+				}
+			}
+		}
+	}
+	return links
+}
+
+// splitLinks splits a Link header value on the commas outside of <...>.
+func splitLinks(v string) []string{
+	var links []string
+	inURL := false
+	start := 0
+	for i, r := range v{
+		switch{
+		case r == '<':
+			inURL = true
+		case r == '>':
+			inURL = false
+		case r == ',' && !inURL:
+			links = append(links, v[start:i])
+			start = i + 1
+		}
+	}
+	return append(links, v[start:])
+}
@@ -0,0 +1,194 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func testPackages(n int) []Package{
+	var packages []Package
+	for i := 0; i < n; i++{
+		packages = append(packages, Package{ID: fmt.Sprintf("package%d-1.0", i), Name: fmt.Sprintf("package%d", i), Version: "1.0"})
+	}
+	return packages
+}
+
+// startPagingServer serves 23 packages, 5 per page (or ?limit=), paginated in the given style.
+// The number of requests is counted in requests.
+func startPagingServer(style string, requests *int32) *httptest.Server{
+	packages := testPackages(23)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		limit := 5
+		if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil{
+			limit = l
+		}
+		var offset int
+		switch style{
+		case "link":
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			offset = page * limit
+		case "cursor":
+			// the cursor is the offset, as a string nobody should interpret
+			offset, _ = strconv.Atoi(r.URL.Query().Get("cursor"))
+		case "offset":
+			offset, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+		}
+		end := offset + limit
+		if end > len(packages){
+			end = len(packages)
+		}
+		items := packages[offset:end]
+
+		switch style{
+		case "link":
+			if end < len(packages){
+				w.Header().Add("Link", fmt.Sprintf(`</packages?page=%d&limit=%d>; rel="next", </packages?page=0>; rel="first"`, end/limit, limit))
+			}
+			writeJSON(w, http.StatusOK, items)
+		case "cursor":
+			env := map[string]interface{}{"items": items}
+			if end < len(packages){
+				env["next_cursor"] = strconv.Itoa(end)
+			}
+			writeJSON(w, http.StatusOK, env)
+		case "offset":
+			writeJSON(w, http.StatusOK, map[string]interface{}{"items": items, "offset": offset, "limit": limit, "total": len(packages)})
+		}
+	}))
+	return ts
+}
+
+func TestPaginationStyles(t *testing.T){
+	for _, style := range []string{"link", "cursor", "offset"}{
+		var requests int32
+		ts := startPagingServer(style, &requests)
+		c, err := NewClient(ts.URL, ts.Client())
+		if err != nil{
+			t.Fatal(err)
+		}
+
+		packages, err := c.List(context.Background())
+		if err != nil{
+			t.Fatalf("%s: %v", style, err)
+		}
+		if len(packages) != 23{
+			t.Fatalf("%s: Expected 23 packages, Got back: %d", style, len(packages))
+		}
+		for i, p := range packages{
+			if p.Name != fmt.Sprintf("package%d", i){
+				t.Fatalf("%s: Expected package%d at position %d, Got: %s", style, i, i, p.Name)
+			}
+		}
+		if requests != 5{
+			t.Errorf("%s: Expected 5 pages to be requested, Got: %d", style, requests)
+		}
+		ts.Close()
+	}
+}
+
+func TestPaginationIsLazy(t *testing.T){
+	var requests int32
+	ts := startPagingServer("cursor", &requests)
+	defer ts.Close()
+	c, _ := NewClient(ts.URL, ts.Client())
+
+	it := c.Packages(context.Background(), &ListOptions{PageSize: 10})
+	if requests != 0{
+		t.Fatalf("Expected no request before Next, Got: %d", requests)
+	}
+	for i := 0; i < 10; i++{
+		if !it.Next(){
+			t.Fatal(it.Err())
+		}
+	}
+	if requests != 1{
+		t.Errorf("Expected 1 request for the first 10 packages, Got: %d", requests)
+	}
+	it.Next()
+	if requests != 2 || it.Package().Name != "package10"{
+		t.Errorf("Expected the second page to start with package10, Got: %s after %d requests", it.Package().Name, requests)
+	}
+}
+
+func TestPaginationCancel(t *testing.T){
+	var requests int32
+	ts := startPagingServer("link", &requests)
+	defer ts.Close()
+	c, _ := NewClient(ts.URL, ts.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	it := c.Packages(ctx, nil)
+	n := 0
+	for it.Next(){
+		n++
+		if n == 7{
+			cancel()
+		}
+	}
+	if n != 7 || !errors.Is(it.Err(), context.Canceled){
+		t.Errorf("Expected to stop after 7 packages with context.Canceled, Got: %d, %v", n, it.Err())
+	}
+	if requests != 2{
+		t.Errorf("Expected 2 pages to be requested, Got: %d", requests)
+	}
+}
+
+func TestPaginationSelfLink(t *testing.T){
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `<`+r.URL.String()+`>; rel="next"`)
+		writeJSON(w, http.StatusOK, testPackages(2))
+	}))
+	defer ts.Close()
+	c, _ := NewClient(ts.URL, ts.Client())
+
+	if _, err := c.List(context.Background()); err == nil{
+		t.Fatal("Expected an error for a page linking to itself")
+	}
+}
+
+func TestPaginationCycle(t *testing.T){
+	// ?page=a links to ?page=b, which links back to ?page=a
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		next := "a"
+		if r.URL.Query().Get("page") == "a"{
+			next = "b"
+		}
+		w.Header().Set("Link", `</packages?page=`+next+`>; rel="next"`)
+		writeJSON(w, http.StatusOK, testPackages(2))
+	}))
+	defer ts.Close()
+	c, _ := NewClient(ts.URL, ts.Client())
+
+	if _, err := c.List(context.Background()); err == nil{
+		t.Fatal("Expected an error for pages linking to each other")
+	}
+	if requests != 3{
+		t.Errorf("Expected 3 pages to be requested before the loop is noticed, Got: %d", requests)
+	}
+}
+
+func TestParseLinkHeader(t *testing.T){
+	links := parseLinkHeader([]string{
+		`<https://example.com/p?a=1,2>; rel="next last", <https://example.com/p?page=0>; rel=first`,
+		`<https://example.com/other>; rel="next"`,
+	})
+	for rel, expected := range map[string]string{
+		"next":		"https://example.com/p?a=1,2",
+		"last":		"https://example.com/p?a=1,2",
+		"first":	"https://example.com/p?page=0",
+	}{
+		if links[rel] != expected{
+			t.Errorf("Expected %s for rel=%s, Got: %q", expected, rel, links[rel])
+		}
+	}
+}
@@ -0,0 +1,205 @@
+/*
+	RFC 7807 (Problem Details for HTTP APIs) gives error responses a
+	standard JSON shape, served as application/problem+json:
+
+		HTTP/1.1 400 Bad Request
+		Content-Type: application/problem+json
+
+		{
+			"type": "https://registry.example.com/probs/invalid-package",
+			"title": "Invalid package",
+			"status": 400,
+			"detail": "2 fields are invalid",
+			"instance": "/packages/requests/42",
+			"invalid-params": [{"name": "version", "reason": "not a semantic version"}],
+			"request_id": "42"
+		}
+
+	type, title, status, detail and instance are the standard members,
+	anything else is an extension member, kept in Extensions (a 413 for an
+	artifact too large usually carries the "limit"). The per-field errors
+	are not standardised: "invalid-params" is the RFC example, "errors" is
+	what most frameworks send, both end up in Errors as the same FieldError
+	used for client-side validation.
+
+	Servers and proxies that do not speak RFC 7807 usually send
+	{"error": "..."}, {"error": {"message": "..."}} or {"message": "..."},
+	or just text (a 503 from a proxy in front of the storage), so the
+	fallback fills Title/Detail from those. Whatever the body, the Client
+	returns a non-2xx response as a *ProblemError, and so do the
+	pkgRegister and multipartData helpers, through DecodeProblem:
+
+		var problem *registry.ProblemError
+		if errors.As(err, &problem) && problem.Status == http.StatusRequestEntityTooLarge{
+			limit, _ := problem.Extensions["limit"].(float64)
+			...
+		}
+
+	ErrNotFound and ErrConflict match the two statuses callers usually
+	branch on, with errors.Is.
+
+*/
+
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNotFound matches (errors.Is) a *ProblemError with status 404.
+	ErrNotFound		= errors.New("registry: not found")
+	// ErrConflict matches a *ProblemError with status 409, e.g. a package registered twice.
+	ErrConflict		= errors.New("registry: conflict")
+)
+
+// ProblemError is returned when the registry answers with a non-2xx status.
+type ProblemError struct{
+	// Type is a URI identifying the kind of problem, "about:blank" when not given.
+	Type		string
+	Title		string
+	Status		int
+	Detail		string
+	Instance	string
+	// Extensions holds the members of the problem other than the standard ones.
+	Extensions	map[string]interface{}
+	// Errors lists the invalid fields reported by the server, if any.
+	Errors		ValidationErrors
+}
+
+func (e *ProblemError) Error() string{
+	msg := fmt.Sprintf("registry: %d %s", e.Status, e.Title)
+	if e.Detail != "" && e.Detail != e.Title{
+		msg += ": " + e.Detail
+	}
+	if len(e.Errors) > 0{
+		msg += " (" + e.Errors.Error() + ")"
+	}
+	return msg
+}
+
+func (e *ProblemError) Is(target error) bool{
+	switch target{
+	case ErrNotFound:
+		return e.Status == http.StatusNotFound
+	case ErrConflict:
+		return e.Status == http.StatusConflict
+	}
+	return false
+}
+
+// the standard members, the rest are extensions
+var problemMembers = map[string]bool{"type": true, "title": true, "status": true, "detail": true, "instance": true}
+
+// DecodeProblem decodes the body of an error response, the status of the response is used when the body has none.
+func DecodeProblem(resp *http.Response, body []byte) *ProblemError{
+	p := &ProblemError{Type: "about:blank", Status: resp.StatusCode}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	var members map[string]json.RawMessage
+	isJSON := mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	if !isJSON || json.Unmarshal(body, &members) != nil{
+		//not a JSON object, the text is the detail
+		p.Detail = strings.TrimSpace(string(body))
+		p.defaultTitle()
+		return p
+	}
+
+	if mediaType == "application/problem+json"{
+		decodeMember(members, "type", &p.Type)
+		decodeMember(members, "title", &p.Title)
+		decodeMember(members, "status", &p.Status)
+		decodeMember(members, "detail", &p.Detail)
+		decodeMember(members, "instance", &p.Instance)
+		for name, raw := range members{
+			if problemMembers[name]{
+				continue
+			}
+			var v interface{}
+			if json.Unmarshal(raw, &v) == nil{
+				if p.Extensions == nil{
+					p.Extensions = map[string]interface{}{}
+				}
+				p.Extensions[name] = v
+			}
+		}
+	}else{
+		p.fallback(members)
+	}
+	p.Errors = fieldErrors(members)
+	p.defaultTitle()
+	return p
+}
+
+// fallback reads the common non-RFC 7807 shapes: {"error": "..."}, {"error": {"message": "..."}}, {"message": "..."}.
+func (p *ProblemError) fallback(members map[string]json.RawMessage){
+	if !decodeMember(members, "error", &p.Detail){
+		var nested map[string]json.RawMessage
+		if decodeMember(members, "error", &nested){
+			decodeMember(nested, "message", &p.Detail)
+			decodeMember(nested, "type", &p.Type)
+			if !decodeMember(nested, "code", &p.Title){
+				decodeMember(members, "title", &p.Title)
+			}
+		}
+	}
+	if p.Detail == ""{
+		if !decodeMember(members, "message", &p.Detail){
+			decodeMember(members, "detail", &p.Detail)
+		}
+	}
+}
+
+func (p *ProblemError) defaultTitle(){
+	if p.Title == ""{
+		p.Title = http.StatusText(p.Status)
+	}
+}
+
+// decodeMember decodes members[name] into v, it reports whether the member exists and has the type of v.
+func decodeMember(members map[string]json.RawMessage, name string, v interface{}) bool{
+	raw, ok := members[name]
+	if !ok{
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+// fieldError is one entry of "invalid-params" or "errors", under the names commonly used for each part.
+type fieldError struct{
+	Name		string		`json:"name"`
+	Field		string		`json:"field"`
+	Pointer		string		`json:"pointer"`
+	Reason		string		`json:"reason"`
+	Message		string		`json:"message"`
+	Detail		string		`json:"detail"`
+}
+
+func fieldErrors(members map[string]json.RawMessage) ValidationErrors{
+	var entries []fieldError
+	if !decodeMember(members, "invalid-params", &entries){
+		decodeMember(members, "errors", &entries)
+	}
+	var errs ValidationErrors
+	for _, e := range entries{
+		fe := FieldError{Field: firstNonEmpty(e.Name, e.Field, strings.TrimPrefix(e.Pointer, "/")), Message: firstNonEmpty(e.Reason, e.Message, e.Detail)}
+		if fe.Field != "" || fe.Message != ""{
+			errs = append(errs, fe)
+		}
+	}
+	return errs
+}
+
+func firstNonEmpty(values ...string) string{
+	for _, v := range values{
+		if v != ""{
+			return v
+		}
+	}
+	return ""
+}
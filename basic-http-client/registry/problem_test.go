@@ -0,0 +1,98 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// registerWithError registers a package on a server answering with status, contentType and body.
+func registerWithError(t *testing.T, status int, contentType, body string) error{
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	defer ts.Close()
+	c, err := NewClient(ts.URL, ts.Client())
+	if err != nil{
+		t.Fatal(err)
+	}
+	_, err = c.Register(context.Background(), PackageData{Name: "mypackage", Version: "0.1"})
+	return err
+}
+
+func TestProblemDetails(t *testing.T){
+	err := registerWithError(t, http.StatusUnprocessableEntity, "application/problem+json", `{
+		"type": "https://registry.example.com/probs/invalid-package",
+		"title": "Invalid package",
+		"status": 422,
+		"detail": "1 field is invalid",
+		"instance": "/packages/requests/42",
+		"invalid-params": [{"name": "version", "reason": "already registered"}],
+		"request_id": "42"
+	}`)
+	var problem *ProblemError
+	if !errors.As(err, &problem){
+		t.Fatalf("Expected a *ProblemError, Got: %T %v", err, err)
+	}
+	if problem.Type != "https://registry.example.com/probs/invalid-package" || problem.Title != "Invalid package" ||
+		problem.Status != 422 || problem.Detail != "1 field is invalid" || problem.Instance != "/packages/requests/42"{
+		t.Errorf("Expected the standard members to be decoded, Got: %+v", problem)
+	}
+	if problem.Extensions["request_id"] != "42" || len(problem.Extensions) != 2{
+		t.Errorf("Expected the extensions request_id and invalid-params, Got: %v", problem.Extensions)
+	}
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "version" || problem.Errors[0].Message != "already registered"{
+		t.Errorf("Expected a field error for version, Got: %v", problem.Errors)
+	}
+}
+
+func TestProblemFallbacks(t *testing.T){
+	tests := []struct{
+		contentType	string
+		body		string
+		title		string
+		detail		string
+		fields		int
+	}{
+		{"application/json", `{"error": "name is taken"}`, "Conflict", "name is taken", 0},
+		{"application/json", `{"error": {"code": "conflict", "message": "name is taken"}}`, "conflict", "name is taken", 0},
+		{"application/json; charset=utf-8", `{"message": "invalid", "errors": [{"field": "name", "message": "taken"}]}`, "Conflict", "invalid", 1},
+		{"text/plain; charset=utf-8", "Bad Request\n", "Conflict", "Bad Request", 0},
+		// status and type default for a problem without them
+		{"application/problem+json", `{"title": "Duplicate"}`, "Duplicate", "", 0},
+	}
+	for _, tt := range tests{
+		err := registerWithError(t, http.StatusConflict, tt.contentType, tt.body)
+		if !errors.Is(err, ErrConflict){
+			t.Errorf("Expected ErrConflict for %s, Got: %v", tt.body, err)
+		}
+		var problem *ProblemError
+		if !errors.As(err, &problem){
+			t.Errorf("Expected a *ProblemError for %s, Got: %v", tt.body, err)
+			continue
+		}
+		if problem.Status != http.StatusConflict || problem.Type != "about:blank"{
+			t.Errorf("Expected status 409 and type about:blank, Got: %d %s", problem.Status, problem.Type)
+		}
+		if problem.Title != tt.title || problem.Detail != tt.detail || len(problem.Errors) != tt.fields{
+			t.Errorf("Expected %q, %q and %d field errors for %s, Got: %q, %q, %v", tt.title, tt.detail, tt.fields, tt.body, problem.Title, problem.Detail, problem.Errors)
+		}
+	}
+}
+
+func TestProblemExtensionsOfAnUpload(t *testing.T){
+	err := registerWithError(t, http.StatusRequestEntityTooLarge, "application/problem+json", `{"title": "Artifact too large", "detail": "the limit is 10 MiB", "limit": 10485760}`)
+	var problem *ProblemError
+	if !errors.As(err, &problem) || problem.Extensions["limit"] != float64(10485760){
+		t.Fatalf("Expected a 413 *ProblemError with the extension limit, Got: %v", err)
+	}
+	if msg := problem.Error(); msg != "registry: 413 Artifact too large: the limit is 10 MiB"{
+		t.Errorf("Expected the status, title and detail in the message, Got: %s", msg)
+	}
+}
@@ -0,0 +1,245 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRegistry is an in-memory registry serving the endpoints of Client.
+type testRegistry struct{
+	mu			sync.Mutex
+	packages	map[string]Package
+}
+
+func newTestRegistry() *testRegistry{
+	return &testRegistry{packages: map[string]Package{}}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}){
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// add stores p under name-version, it reports false if the package exists.
+func (reg *testRegistry) add(p Package) (Package, bool){
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	p.ID = p.Name + "-" + p.Version
+	if _, ok := reg.packages[p.ID]; ok{
+		return p, false
+	}
+	reg.packages[p.ID] = p
+	return p, true
+}
+
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request){
+	switch{
+	case r.URL.Path == "/packages" && r.Method == http.MethodGet:
+		reg.mu.Lock()
+		list := []Package{}
+		for _, p := range reg.packages{
+			list = append(list, p)
+		}
+		reg.mu.Unlock()
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		writeJSON(w, http.StatusOK, list)
+
+	case r.URL.Path == "/packages" && r.Method == http.MethodPost:
+		var data PackageData
+		//"forbidden" passes the validation of the client, the registry refuses it
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Name == "" || data.Version == "" || data.Name == "forbidden"{
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		p, ok := reg.add(Package{Name: data.Name, Version: data.Version})
+		if !ok{
+			http.Error(w, "package already registered", http.StatusConflict)
+			return
+		}
+		writeJSON(w, http.StatusOK, RegisterResult{ID: p.ID})
+
+	case r.URL.Path == "/uploads" && r.Method == http.MethodPost:
+		if err := r.ParseMultipartForm(5000); err != nil{
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		files := r.MultipartForm.File["filedata"]
+		if len(files) == 0{
+			http.Error(w, "filedata is missing", http.StatusBadRequest)
+			return
+		}
+		p, ok := reg.add(Package{Name: r.FormValue("name"), Version: r.FormValue("version"), Filename: files[0].Filename, Size: files[0].Size})
+		if !ok{
+			http.Error(w, "package already registered", http.StatusConflict)
+			return
+		}
+		writeJSON(w, http.StatusOK, UploadResult{ID: p.ID, Filename: p.Filename, Size: p.Size})
+
+	case strings.HasPrefix(r.URL.Path, "/packages/"):
+		id := strings.TrimPrefix(r.URL.Path, "/packages/")
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		p, ok := reg.packages[id]
+		if !ok{
+			http.Error(w, "package not found", http.StatusNotFound)
+			return
+		}
+		switch r.Method{
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, p)
+		case http.MethodPut:
+			var data PackageData
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil{
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			p.Name, p.Version = data.Name, data.Version
+			reg.packages[id] = p
+			writeJSON(w, http.StatusOK, p)
+		case http.MethodDelete:
+			delete(reg.packages, id)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Invalid HTTP Method specified", http.StatusMethodNotAllowed)
+		}
+
+	default:
+		http.Error(w, "Invalid HTTP Method specified", http.StatusMethodNotAllowed)
+	}
+}
+
+func startTestRegistry(t *testing.T) (*httptest.Server, *Client){
+	t.Helper()
+	ts := httptest.NewServer(newTestRegistry())
+	c, err := NewClient(ts.URL, ts.Client())
+	if err != nil{
+		t.Fatal(err)
+	}
+	return ts, c
+}
+
+func TestRegisterGetList(t *testing.T){
+	ts, c := startTestRegistry(t)
+	defer ts.Close()
+	ctx := context.Background()
+
+	for _, p := range []PackageData{{Name: "package1", Version: "1.1"}, {Name: "package2", Version: "1.0"}}{
+		result, err := c.Register(ctx, p)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if result.ID != p.Name+"-"+p.Version{
+			t.Errorf("Expected package id to be %s-%s, Got: %s", p.Name, p.Version, result.ID)
+		}
+	}
+
+	packages, err := c.List(ctx)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if len(packages) != 2{
+		t.Fatalf("Expected 2 packages, Got back: %d", len(packages))
+	}
+
+	p, err := c.Get(ctx, "package2-1.0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	if p.Name != "package2" || p.Version != "1.0"{
+		t.Errorf("Expected package2 1.0, Got: %+v", p)
+	}
+}
+
+func TestUpload(t *testing.T){
+	ts, c := startTestRegistry(t)
+	defer ts.Close()
+
+	a := Artifact{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Bytes: strings.NewReader("data")}
+	result, err := c.Upload(context.Background(), a)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if result.ID != "mypackage-0.1" || result.Filename != a.Filename || result.Size != 4{
+		t.Errorf("Expected mypackage-0.1 with a 4 bytes %s, Got: %+v", a.Filename, result)
+	}
+}
+
+func TestUpdateDelete(t *testing.T){
+	ts, c := startTestRegistry(t)
+	defer ts.Close()
+	ctx := context.Background()
+
+	if _, err := c.Register(ctx, PackageData{Name: "mypackage", Version: "0.1"}); err != nil{
+		t.Fatal(err)
+	}
+	p, err := c.Update(ctx, "mypackage-0.1", PackageData{Name: "mypackage", Version: "0.1.1"})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if p.ID != "mypackage-0.1" || p.Version != "0.1.1"{
+		t.Errorf("Expected the updated package, Got: %+v", p)
+	}
+
+	if err := c.Delete(ctx, "mypackage-0.1"); err != nil{
+		t.Fatal(err)
+	}
+	_, err = c.Get(ctx, "mypackage-0.1")
+	if !errors.Is(err, ErrNotFound){
+		t.Fatalf("Expected ErrNotFound after delete, Got: %v", err)
+	}
+}
+
+func TestErrors(t *testing.T){
+	ts, c := startTestRegistry(t)
+	defer ts.Close()
+	ctx := context.Background()
+
+	_, err := c.Register(ctx, PackageData{Name: "forbidden", Version: "0.1"})
+	var problem *ProblemError
+	if !errors.As(err, &problem) || problem.Status != http.StatusBadRequest || problem.Detail != "Bad Request"{
+		t.Errorf("Expected a 400 *ProblemError, Got: %v", err)
+	}
+
+	c.Register(ctx, PackageData{Name: "mypackage", Version: "0.1"})
+	if _, err := c.Register(ctx, PackageData{Name: "mypackage", Version: "0.1"}); !errors.Is(err, ErrConflict){
+		t.Errorf("Expected ErrConflict for a duplicate, Got: %v", err)
+	}
+
+	if err := c.Delete(ctx, "unknown"); !errors.Is(err, ErrNotFound){
+		t.Errorf("Expected ErrNotFound, Got: %v", err)
+	}
+
+	if _, err := NewClient("ftp://registry", nil); err == nil{
+		t.Error("Expected an error for a non-http base URL")
+	}
+}
+
+func TestBaseURLWithPath(t *testing.T){
+	var gotPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"a/b"}`)
+	}))
+	defer ts.Close()
+
+	c, err := NewClient(ts.URL+"/api/v1/", nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, err := c.Get(context.Background(), "a/b"); err != nil{
+		t.Fatal(err)
+	}
+	if gotPath != "/api/v1/packages/a%2Fb"{
+		t.Errorf("Expected /api/v1/packages/a%%2Fb, Got: %s", gotPath)
+	}
+}
@@ -0,0 +1,317 @@
+/*
+	An upload used to be built in a bytes.Buffer before the request was
+	sent, so uploading a 4 GB package needed 4 GB of memory.
+
+	NewUploadRequest streams it instead. io.Pipe connects the
+	multipart.Writer, running in its own goroutine, to the request body:
+	each Write of the writer blocks until the transport Reads it, so only
+	the io.Copy buffer (32 KB) is in memory whatever the size of the file.
+
+		goroutine: multipart.Writer -> io.PipeWriter
+		                                    |
+		transport: request body    <- io.PipeReader
+
+	Errors go both ways:
+	- a failed read of the file (or a file over MaxArtifactSize) closes the
+	  pipe with that error, the transport gets it from Read and aborts the
+	  request; the error is also kept to be returned as it is, rather than
+	  wrapped by the transport.
+	- if the transport stops reading (the server closed the connection), it
+	  closes the body, the next Write of the goroutine fails with
+	  io.ErrClosedPipe and the goroutine ends.
+
+	Content-Length: when the size of the file is known (Artifact.Path, or a
+	reader with Len or Stat), the size of the message is the size of the
+	parts with an empty file, plus the size of the file. The boundary is
+	chosen up front so that both messages have the same.
+
+	A reader that can not tell its size is first copied to a temporary
+	file, up to MaxArtifactSize: an oversized artifact is refused before
+	any request is sent, and the temporary file is then sent like
+	Artifact.Path. Only a file that is not a regular one (a named pipe) is
+	sent chunked.
+
+	GetBody: a pipe can only be read once, so redirects (307/308) and
+	retries need a new body. When the file comes from Artifact.Path it can
+	be opened again, and GetBody starts a new pipe on it. Every body opened
+	is kept: once the client is done they are all closed, and the error of
+	the last one, the body the final response answered, is the one that
+	counts.
+
+	Client.Upload (and so RegisterAll) sends its artifacts this way, and so
+	does the multipartData helper:
+
+		req, done, err := registry.NewUploadRequest(ctx, url, a)
+		...
+		resp, err := client.Do(req)
+		if werr := done(); werr != nil{
+			//the file could not be sent: read error, too large
+		}
+
+*/
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// multipartBody is a request body streamed from a goroutine.
+type multipartBody struct{
+	*io.PipeReader
+	// done receives the error of the goroutine (nil on success) when it ends.
+	done	chan error
+}
+
+type streamedMessage struct{
+	contentType		string
+	// contentLength is -1 when the size of the file is not known.
+	contentLength	int64
+	// open returns a new body, each call reads the file from the start if it can be re-opened.
+	open			func() (*multipartBody, error)
+	// reopenable is true if open can be called more than once.
+	reopenable		bool
+
+	mu				sync.Mutex
+	// bodies are the bodies returned by open, in order.
+	bodies			[]*multipartBody
+}
+
+// opened records body as the latest body of the message.
+func (m *streamedMessage) opened(body *multipartBody) *multipartBody{
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bodies = append(m.bodies, body)
+	return body
+}
+
+// finish closes every body, stopping the goroutines the transport left behind, and returns the error of the last one.
+func (m *streamedMessage) finish() error{
+	m.mu.Lock()
+	bodies := m.bodies
+	m.mu.Unlock()
+	if len(bodies) == 0{
+		return nil
+	}
+	for _, body := range bodies{
+		body.Close()
+	}
+	return <-bodies[len(bodies)-1].done
+}
+
+// writeParts writes the fields name and version and the file filedata, copied from src.
+func writeParts(mw *multipart.Writer, a Artifact, src io.Reader) error{
+	for _, field := range []struct{ name, value string }{{"name", a.Name}, {"version", a.Version}}{
+		fw, err := mw.CreateFormField(field.name)
+		if err != nil{
+			return err
+		}
+		if _, err := io.WriteString(fw, field.value); err != nil{
+			return err
+		}
+	}
+	fw, err := mw.CreateFormFile("filedata", a.Filename)
+	if err != nil{
+		return err
+	}
+	// the copy stops one byte past MaxArtifactSize, for a file that grew since it was validated
+	n, err := io.Copy(fw, io.LimitReader(src, MaxArtifactSize+1))
+	if err != nil{
+		return err
+	}
+	if fe := sizeError(n); fe != nil{
+		return ValidationErrors{*fe}
+	}
+	return mw.Close()
+}
+
+type countingWriter struct{
+	n	int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error){
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// messageLength returns the length of the message with a file of size bytes.
+func messageLength(boundary string, a Artifact, size int64) (int64, error){
+	var c countingWriter
+	mw := multipart.NewWriter(&c)
+	if err := mw.SetBoundary(boundary); err != nil{
+		return 0, err
+	}
+	// an empty file would fail the size check, so the parts are written by hand
+	for _, field := range []struct{ name, value string }{{"name", a.Name}, {"version", a.Version}}{
+		fw, err := mw.CreateFormField(field.name)
+		if err != nil{
+			return 0, err
+		}
+		io.WriteString(fw, field.value)
+	}
+	if _, err := mw.CreateFormFile("filedata", a.Filename); err != nil{
+		return 0, err
+	}
+	if err := mw.Close(); err != nil{
+		return 0, err
+	}
+	return c.n + size, nil
+}
+
+// stream starts the goroutine writing the message with src as the file, it closes src when done.
+func stream(boundary string, a Artifact, src io.Reader) *multipartBody{
+	pr, pw := io.Pipe()
+	body := &multipartBody{PipeReader: pr, done: make(chan error, 1)}
+	go func(){
+		mw := multipart.NewWriter(pw)
+		err := mw.SetBoundary(boundary)
+		if err == nil{
+			err = writeParts(mw, a, src)
+		}
+		if c, ok := src.(io.Closer); ok && a.Path != ""{
+			c.Close()
+		}
+		if err != nil{
+			// wrapped, net/http compares the errors of the body with == and ValidationErrors is a slice
+			pw.CloseWithError(fmt.Errorf("multipart body: %w", err))
+		}else{
+			// the end of the body
+			pw.Close()
+		}
+		body.done <- err
+	}()
+	return body
+}
+
+// newMultipartBody prepares the streamed message of a, the goroutine starts with the first call to open.
+func newMultipartBody(a Artifact) (*streamedMessage, error){
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	msg := &streamedMessage{
+		contentType:	"multipart/form-data; boundary=" + boundary,
+		contentLength:	-1,
+	}
+
+	var size int64
+	var sizeKnown bool
+	if a.Path != ""{
+		fi, err := os.Stat(a.Path)
+		if err != nil{
+			return nil, err
+		}
+		size, sizeKnown = fi.Size(), fi.Mode().IsRegular()
+		msg.reopenable = true
+		msg.open = func() (*multipartBody, error){
+			f, err := os.Open(a.Path)
+			if err != nil{
+				return nil, err
+			}
+			return msg.opened(stream(boundary, a, f)), nil
+		}
+	}else{
+		size, sizeKnown = artifactSize(a.Bytes)
+		used := false
+		msg.open = func() (*multipartBody, error){
+			if used{
+				return nil, fmt.Errorf("the artifact of %s %s can only be read once", a.Name, a.Version)
+			}
+			used = true
+			return msg.opened(stream(boundary, a, a.Bytes)), nil
+		}
+	}
+
+	if sizeKnown{
+		n, err := messageLength(boundary, a, size)
+		if err != nil{
+			return nil, err
+		}
+		msg.contentLength = n
+	}
+	return msg, nil
+}
+
+// spoolArtifact copies r to a temporary file and returns its path, the caller removes it.
+// The copy stops one byte past MaxArtifactSize, a larger artifact is a ValidationErrors.
+func spoolArtifact(r io.Reader) (string, error){
+	f, err := os.CreateTemp("", "registry-artifact-*")
+	if err != nil{
+		return "", err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, MaxArtifactSize+1))
+	if cerr := f.Close(); err == nil{
+		err = cerr
+	}
+	if err == nil{
+		if fe := sizeError(n); fe != nil{
+			err = ValidationErrors{*fe}
+		}
+	}
+	if err != nil{
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// NewUploadRequest returns the POST of a to url as a multipart message (fields name and version, file filedata)
+// streamed while the transport sends it. a is expected to be valid (ValidateArtifact), its size is checked again as it is read.
+// done must be called once the response is received, or the request failed: it stops the streams and returns the error
+// of the file, if the last body sent could not be written (nil if the transport stopped reading it).
+func NewUploadRequest(ctx context.Context, url string, a Artifact) (req *http.Request, done func() error, err error){
+	//a reader that can not tell its size is copied to a file first: an oversized artifact is refused before sending anything
+	spooled := ""
+	if a.Path == ""{
+		if _, ok := artifactSize(a.Bytes); !ok{
+			if spooled, err = spoolArtifact(a.Bytes); err != nil{
+				return nil, nil, err
+			}
+			a.Path, a.Bytes = spooled, nil
+		}
+	}
+	cleanup := func(){
+		if spooled != ""{
+			os.Remove(spooled)
+		}
+	}
+
+	msg, err := newMultipartBody(a)
+	if err != nil{
+		cleanup()
+		return nil, nil, err
+	}
+	body, err := msg.open()
+	if err != nil{
+		cleanup()
+		return nil, nil, err
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil{
+		msg.finish()
+		cleanup()
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", msg.contentType)
+	//-1 sends the body chunked
+	req.ContentLength = msg.contentLength
+	if msg.reopenable{
+		req.GetBody = func() (io.ReadCloser, error){
+			return msg.open()
+		}
+	}
+
+	done = func() error{
+		defer cleanup()
+		//the server answering before the end of the file is not an error of the file
+		if err := msg.finish(); err != nil && !errors.Is(err, io.ErrClosedPipe){
+			return err
+		}
+		return nil
+	}
+	return req, done, nil
+}
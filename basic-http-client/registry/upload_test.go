@@ -0,0 +1,220 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bodyInfo is what the test server saw of an upload.
+type bodyInfo struct{
+	contentLength	int64
+	chunked			bool
+	read			int64
+}
+
+// startUploadServer registers the uploads in a testRegistry and sends what it saw of each body to seen.
+func startUploadServer(seen chan<- bodyInfo) *httptest.Server{
+	reg := newTestRegistry()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		info := bodyInfo{contentLength: r.ContentLength, read: int64(len(data))}
+		for _, te := range r.TransferEncoding{
+			info.chunked = info.chunked || te == "chunked"
+		}
+		seen <- info
+		r.Body = io.NopCloser(strings.NewReader(string(data)))
+		reg.ServeHTTP(w, r)
+	}))
+}
+
+// uploadTo sends a with a Client of ts.
+func uploadTo(t *testing.T, ts *httptest.Server, a Artifact) (UploadResult, error){
+	t.Helper()
+	c, err := NewClient(ts.URL, ts.Client())
+	if err != nil{
+		t.Fatal(err)
+	}
+	return c.Upload(context.Background(), a)
+}
+
+func TestStreamedContentLength(t *testing.T){
+	seen := make(chan bodyInfo, 2)
+	ts := startUploadServer(seen)
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "mypackage-0.1.tar.gz")
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 100000)), 0644); err != nil{
+		t.Fatal(err)
+	}
+	for _, p := range []Artifact{
+		{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Bytes: strings.NewReader("data")},
+		{Name: "mypackage", Version: "0.2", Filename: "mypackage-0.1.tar.gz", Path: path},
+	}{
+		result, err := uploadTo(t, ts, p)
+		if err != nil{
+			t.Fatal(err)
+		}
+		info := <-seen
+		if info.chunked || info.contentLength != info.read{
+			t.Errorf("Expected a Content-Length of %d bytes, Got: %d (chunked: %v)", info.read, info.contentLength, info.chunked)
+		}
+		if result.Filename != "mypackage-0.1.tar.gz"{
+			t.Errorf("Expected the filename mypackage-0.1.tar.gz, Got: %s", result.Filename)
+		}
+	}
+}
+
+func TestStreamedUnknownSizeIsSpooled(t *testing.T){
+	seen := make(chan bodyInfo, 1)
+	ts := startUploadServer(seen)
+	defer ts.Close()
+
+	// io.MultiReader hides the size of the strings.Reader, it is copied to a file with a known size
+	p := Artifact{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Bytes: io.MultiReader(strings.NewReader("data"))}
+	result, err := uploadTo(t, ts, p)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if info := <-seen; info.chunked || info.contentLength != info.read{
+		t.Errorf("Expected a Content-Length of %d bytes, Got: %+v", info.read, info)
+	}
+	if result.Size != 4 || result.Filename != "mypackage-0.1.tar.gz"{
+		t.Errorf("Expected mypackage-0.1.tar.gz with 4 bytes, Got: %+v", result)
+	}
+}
+
+// sizedPipe is a pipe that tells its size, so it is streamed rather than spooled.
+type sizedPipe struct{
+	*io.PipeReader
+	size	int
+}
+
+func (s sizedPipe) Len() int{
+	return s.size
+}
+
+func TestStreamedBodyIsNotBuffered(t *testing.T){
+	received := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first bytes arrive while the rest of the file is not written yet
+		buf := make([]byte, 1)
+		io.ReadFull(r.Body, buf)
+		close(received)
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id": "mypackage-0.1"}`)
+	}))
+	defer ts.Close()
+
+	pr, pw := io.Pipe()
+	go func(){
+		// 21 bytes in all
+		io.WriteString(pw, "first part")
+		select{
+		case <-received:
+			io.WriteString(pw, "second part")
+			pw.Close()
+		case <-time.After(5 *time.Second):
+			pw.CloseWithError(errors.New("the server got nothing before the end of the file"))
+		}
+	}()
+
+	p := Artifact{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Bytes: sizedPipe{pr, 21}}
+	if _, err := uploadTo(t, ts, p); err != nil{
+		t.Fatal(err)
+	}
+}
+
+// failingReader returns err after n bytes.
+type failingReader struct{
+	n	int
+	err	error
+}
+
+func (f *failingReader) Read(p []byte) (int, error){
+	if f.n == 0{
+		return 0, f.err
+	}
+	if len(p) > f.n{
+		p = p[:f.n]
+	}
+	for i := range p{
+		p[i] = 'x'
+	}
+	f.n -= len(p)
+	return len(p), nil
+}
+
+func TestStreamedReadErrorIsReturned(t *testing.T){
+	seen := make(chan bodyInfo, 1)
+	ts := startUploadServer(seen)
+	defer ts.Close()
+
+	errDisk := errors.New("disk failure")
+	p := Artifact{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Bytes: &failingReader{n: 50000, err: errDisk}}
+	if _, err := uploadTo(t, ts, p); !errors.Is(err, errDisk){
+		t.Errorf("Expected the error of the reader, Got: %v", err)
+	}
+}
+
+func TestStreamedBodyFollowsRedirect(t *testing.T){
+	seen := make(chan bodyInfo, 2)
+	upload := startUploadServer(seen)
+	defer upload.Close()
+	// 307 keeps the method and the body, the client needs GetBody to send it again
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		http.Redirect(w, r, upload.URL+"/uploads", http.StatusTemporaryRedirect)
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "mypackage-0.1.tar.gz")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil{
+		t.Fatal(err)
+	}
+	result, err := uploadTo(t, ts, Artifact{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Path: path})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if result.ID != "mypackage-0.1" || result.Size != 4{
+		t.Errorf("Expected mypackage-0.1 with 4 bytes after the redirect, Got: %+v", result)
+	}
+
+	// a reader can not be sent again, the redirect is returned as an error
+	p := Artifact{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Bytes: strings.NewReader("data")}
+	var problem *ProblemError
+	if _, err := uploadTo(t, ts, p); !errors.As(err, &problem) || problem.Status != http.StatusTemporaryRedirect{
+		t.Errorf("Expected a 307 *ProblemError, Got: %v", err)
+	}
+}
+
+func TestStreamedErrorOfLastBody(t *testing.T){
+	seen := make(chan bodyInfo, 1)
+	upload := startUploadServer(seen)
+	defer upload.Close()
+	path := filepath.Join(t.TempDir(), "mypackage-0.1.tar.gz")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil{
+		t.Fatal(err)
+	}
+	// the file is emptied before the redirect, the body sent again by GetBody fails
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		os.Truncate(path, 0)
+		http.Redirect(w, r, upload.URL+"/uploads", http.StatusTemporaryRedirect)
+	}))
+	defer ts.Close()
+
+	_, err := uploadTo(t, ts, Artifact{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Path: path})
+	// returned as it is, not as the error of the transport
+	if verrs, ok := err.(ValidationErrors); !ok || verrs[0].Field != "bytes"{
+		t.Errorf("Expected the error of the body sent after the redirect, Got: %v", err)
+	}
+}
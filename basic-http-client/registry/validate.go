@@ -0,0 +1,218 @@
+/*
+	The registry answers a bad payload with a "400 Bad Request", one
+	problem per round trip, and a bad upload only once the whole file has
+	been sent. So the rules of the registry are checked here, before any
+	network call, and every problem is reported at once:
+
+		name: must not be empty
+		version: "1.0.0.0" is not a semantic version (MAJOR.MINOR.PATCH)
+		filename: extension ".exe" is not one of .tar.gz, .tgz, .zip, .whl, .jar
+
+	ValidatePackageData checks the metadata of a registration (name,
+	version), ValidateArtifact an upload: the same name and version form
+	fields, the filename of the file part (a file name, not a path, with a
+	known package extension) and the artifact, Path must exist, Bytes must
+	be given, and neither may be empty or larger than MaxArtifactSize.
+	The size of a reader is only known up front for a *os.File (Stat) or
+	an in-memory reader (Len: bytes.Reader, strings.Reader, bytes.Buffer).
+
+	Client.Register, Client.Upload and RegisterAll (for every entry of the
+	manifest, before the workers start) call them, and so do the pkgRegister
+	and multipartData helpers. The result is a ValidationErrors, a list of
+	FieldError, which the caller gets back with errors.As:
+
+		var verrs registry.ValidationErrors
+		if errors.As(err, &verrs){
+			for _, fe := range verrs{ ... }
+		}
+
+*/
+
+package registry
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxNameLength	= 64
+	// MaxArtifactSize is the largest file the registry accepts, 100 MiB.
+	MaxArtifactSize	= 100 << 20
+)
+
+var (
+	// a letter, then letters, digits, '.', '_' or '-'
+	namePattern		= regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._-]*$`)
+	// MAJOR[.MINOR[.PATCH]][-PRERELEASE][+BUILD], older packages were registered as "0.1"
+	versionPattern	= regexp.MustCompile(`^v?(0|[1-9][0-9]*)(\.(0|[1-9][0-9]*)){0,2}(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+	// the longest extensions first, so that .tar.gz is not reported as .gz
+	artifactExtensions	= []string{".tar.gz", ".tgz", ".zip", ".whl", ".jar"}
+)
+
+// FieldError is one problem with a registration or an upload.
+type FieldError struct{
+	// Field is the JSON member or form field (name, version), filename for the file part, or bytes / path for the artifact.
+	Field	string
+	// Value is the rejected value, the size in bytes for the artifact.
+	Value	string
+	Message	string
+}
+
+func (e FieldError) Error() string{
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationErrors lists every problem found, in the order of the payload.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string{
+	msgs := make([]string, len(v))
+	for i, e := range v{
+		msgs[i] = e.Error()
+	}
+	return "invalid package: " + strings.Join(msgs, "; ")
+}
+
+// Fields returns the names of the invalid fields, in order, e.g. to highlight them in a form.
+func (v ValidationErrors) Fields() []string{
+	fields := make([]string, len(v))
+	for i, e := range v{
+		fields[i] = e.Field
+	}
+	return fields
+}
+
+func validateName(name string) *FieldError{
+	switch{
+	case name == "":
+		return &FieldError{Field: "name", Message: "must not be empty"}
+	case len(name) > maxNameLength:
+		return &FieldError{Field: "name", Value: name, Message: fmt.Sprintf("must be at most %d characters", maxNameLength)}
+	case !namePattern.MatchString(name):
+		return &FieldError{Field: "name", Value: name, Message: fmt.Sprintf("%q must start with a letter and contain only letters, digits, '.', '_' and '-'", name)}
+	}
+	return nil
+}
+
+func validateVersion(version string) *FieldError{
+	switch{
+	case version == "":
+		return &FieldError{Field: "version", Message: "must not be empty"}
+	case !versionPattern.MatchString(version):
+		return &FieldError{Field: "version", Value: version, Message: fmt.Sprintf("%q is not a semantic version (MAJOR.MINOR.PATCH)", version)}
+	}
+	return nil
+}
+
+// validateFilename checks the filename sent with the file part.
+func validateFilename(filename string) *FieldError{
+	if filename == ""{
+		return &FieldError{Field: "filename", Message: "must not be empty"}
+	}
+	//the server stores the file under this name, it must not be a path
+	if strings.ContainsAny(filename, `/\`) || filename == "." || filename == ".."{
+		return &FieldError{Field: "filename", Value: filename, Message: fmt.Sprintf("%q must be a file name, not a path", filename)}
+	}
+	lower := strings.ToLower(filename)
+	for _, ext := range artifactExtensions{
+		if strings.HasSuffix(lower, ext) && len(lower) > len(ext){
+			return nil
+		}
+	}
+	return &FieldError{Field: "filename", Value: filename, Message: fmt.Sprintf("extension %q is not one of %s", path.Ext(filename), strings.Join(artifactExtensions, ", "))}
+}
+
+// sizeError checks the size of the artifact, it is also used once the size of a reader is known.
+func sizeError(size int64) *FieldError{
+	switch{
+	case size == 0:
+		return &FieldError{Field: "bytes", Message: "the artifact is empty"}
+	case size > MaxArtifactSize:
+		return &FieldError{Field: "bytes", Value: fmt.Sprint(size), Message: fmt.Sprintf("the artifact is %d bytes, the limit is %d", size, MaxArtifactSize)}
+	}
+	return nil
+}
+
+// artifactSize returns the number of bytes left in r, if r can tell without being read.
+func artifactSize(r interface{}) (int64, bool){
+	switch r := r.(type){
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	case interface{ Stat() (os.FileInfo, error) }:
+		fi, err := r.Stat()
+		if err != nil || !fi.Mode().IsRegular(){
+			return 0, false
+		}
+		//the file may have been partly read already
+		if s, ok := r.(interface{ Seek(int64, int) (int64, error) }); ok{
+			if offset, err := s.Seek(0, io.SeekCurrent); err == nil{
+				return fi.Size() - offset, true
+			}
+		}
+		return fi.Size(), true
+	}
+	return 0, false
+}
+
+// validateContent checks what is known of the artifact without reading it.
+func validateContent(a Artifact) *FieldError{
+	if a.Path != ""{
+		fi, err := os.Stat(a.Path)
+		if err != nil{
+			return &FieldError{Field: "path", Value: a.Path, Message: err.Error()}
+		}
+		return sizeError(fi.Size())
+	}
+	if a.Bytes == nil{
+		return &FieldError{Field: "bytes", Message: "no artifact to upload"}
+	}
+	if size, ok := artifactSize(a.Bytes); ok{
+		return sizeError(size)
+	}
+	return nil
+}
+
+// collect returns the non-nil errors as a ValidationErrors, or nil.
+func collect(fieldErrors ...*FieldError) error{
+	var errs ValidationErrors
+	for _, fe := range fieldErrors{
+		if fe != nil{
+			errs = append(errs, *fe)
+		}
+	}
+	//return an untyped nil, a nil ValidationErrors in an error interface is not == nil
+	if len(errs) == 0{
+		return nil
+	}
+	return errs
+}
+
+// ValidatePackageData returns a ValidationErrors with every problem of the metadata of a registration, or nil.
+func ValidatePackageData(data PackageData) error{
+	return collect(validateName(data.Name), validateVersion(data.Version))
+}
+
+// ValidateArtifact returns a ValidationErrors with every problem of an upload, or nil.
+// A reader whose size cannot be known is checked while it is sent.
+func ValidateArtifact(a Artifact) error{
+	return collect(validateName(a.Name), validateVersion(a.Version), validateFilename(a.Filename), validateContent(a))
+}
+
+// artifact is the upload of an entry of a manifest.
+func (e ManifestEntry) artifact() Artifact{
+	return Artifact{Name: e.Name, Version: e.Version, Filename: filepath.Base(e.Artifact), Path: e.Artifact}
+}
+
+// validateEntry checks an entry of a manifest as Register or Upload would.
+func validateEntry(e ManifestEntry) error{
+	if e.Artifact == ""{
+		return ValidatePackageData(PackageData{Name: e.Name, Version: e.Version})
+	}
+	return ValidateArtifact(e.artifact())
+}
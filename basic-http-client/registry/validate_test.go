@@ -0,0 +1,132 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePackageData(t *testing.T){
+	for _, p := range []PackageData{
+		{Name: "MyPackage", Version: "0.1"},
+		{Name: "my-package_2.go", Version: "1.2.3-rc.1+build.5"},
+		{Name: "p", Version: "v2"},
+	}{
+		if err := ValidatePackageData(p); err != nil{
+			t.Errorf("Expected %+v to be valid, Got: %v", p, err)
+		}
+	}
+
+	tests := []struct{
+		data	PackageData
+		fields	string
+	}{
+		{PackageData{}, "name,version"},
+		{PackageData{Name: "1package", Version: "1.0"}, "name"},
+		{PackageData{Name: "my package", Version: "1.0"}, "name"},
+		{PackageData{Name: strings.Repeat("a", maxNameLength+1), Version: "1.0"}, "name"},
+		{PackageData{Name: "pkg", Version: "1.0.0.0"}, "version"},
+		{PackageData{Name: "pkg", Version: "01.2"}, "version"},
+		{PackageData{Name: "pkg/x", Version: "latest"}, "name,version"},
+	}
+	for _, tt := range tests{
+		err := ValidatePackageData(tt.data)
+		var verrs ValidationErrors
+		if !errors.As(err, &verrs){
+			t.Errorf("Expected ValidationErrors for %+v, Got: %v", tt.data, err)
+			continue
+		}
+		if got := strings.Join(verrs.Fields(), ","); got != tt.fields{
+			t.Errorf("Expected errors for %s, Got: %s (%v)", tt.fields, got, err)
+		}
+	}
+}
+
+func TestValidateArtifact(t *testing.T){
+	valid := Artifact{Name: "mypackage", Version: "0.1", Filename: "mypackage-0.1.tar.gz", Bytes: strings.NewReader("data")}
+	if err := ValidateArtifact(valid); err != nil{
+		t.Errorf("Expected the artifact to be valid, Got: %v", err)
+	}
+
+	// an empty upload reports every field at once
+	err := ValidateArtifact(Artifact{})
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs){
+		t.Fatalf("Expected ValidationErrors, Got: %v", err)
+	}
+	if got := strings.Join(verrs.Fields(), ","); got != "name,version,filename,bytes"{
+		t.Errorf("Expected errors for name,version,filename,bytes, Got: %s", got)
+	}
+
+	for _, tt := range []struct{
+		filename	string
+		bytes		io.Reader
+		path		string
+		field		string
+	}{
+		{"mypackage.exe", strings.NewReader("data"), "", "filename"},
+		{".tar.gz", strings.NewReader("data"), "", "filename"},
+		{"../mypackage.zip", strings.NewReader("data"), "", "filename"},
+		{"mypackage.tgz", strings.NewReader(""), "", "bytes"},
+		{"mypackage.tgz", strings.NewReader(strings.Repeat("a", MaxArtifactSize+1)), "", "bytes"},
+		{"mypackage.tgz", nil, filepath.Join(t.TempDir(), "missing.tgz"), "path"},
+	}{
+		a := Artifact{Name: "mypackage", Version: "0.1", Filename: tt.filename, Bytes: tt.bytes, Path: tt.path}
+		err := ValidateArtifact(a)
+		if !errors.As(err, &verrs) || len(verrs) != 1 || verrs[0].Field != tt.field{
+			t.Errorf("Expected one error for %s with %s, Got: %v", tt.field, tt.filename, err)
+		}
+	}
+}
+
+func TestArtifactSizeFile(t *testing.T){
+	name := filepath.Join(t.TempDir(), "mypackage.tar.gz")
+	if err := os.WriteFile(name, []byte("0123456789"), 0644); err != nil{
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Seek(4, io.SeekStart)
+	if size, ok := artifactSize(f); !ok || size != 6{
+		t.Errorf("Expected 6 bytes left, Got: %d, %v", size, ok)
+	}
+}
+
+func TestClientValidatesBeforeSending(t *testing.T){
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer ts.Close()
+	c, err := NewClient(ts.URL, nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var verrs ValidationErrors
+	if _, err := c.Register(ctx, PackageData{Name: "", Version: "one"}); !errors.As(err, &verrs) || len(verrs) != 2{
+		t.Errorf("Expected 2 validation errors, Got: %v", err)
+	}
+	if _, err := c.Upload(ctx, Artifact{Name: "mypackage", Version: "0.1", Filename: "mypackage.exe", Bytes: strings.NewReader("data")}); !errors.As(err, &verrs){
+		t.Errorf("Expected a validation error, Got: %v", err)
+	}
+	// a reader without Len or Stat, only checked while building the message
+	big := io.MultiReader(strings.NewReader(strings.Repeat("a", MaxArtifactSize)), strings.NewReader("a"))
+	if _, err := c.Upload(ctx, Artifact{Name: "mypackage", Version: "0.1", Filename: "mypackage.tgz", Bytes: big}); !errors.As(err, &verrs) || verrs[0].Field != "bytes"{
+		t.Errorf("Expected a validation error for bytes, Got: %v", err)
+	}
+	if requests != 0{
+		t.Errorf("Expected no request to be sent, Got: %d", requests)
+	}
+}